@@ -1,13 +1,15 @@
 package client
 
 import (
+	"context"
 	"encoding/base64"
 	"io"
 	"net/http"
 	"net/url"
-	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -30,7 +32,16 @@ type ListType string
 const (
 	ListTypeALBUM  ListType = "albums"
 	ListTypeTRACK  ListType = "tracks"
-	listTypeARTIST ListType = "artists"
+	ListTypeARTIST ListType = "artists"
+)
+
+// FileIntent tells Qobuz what a file url is for, purchases can be downloaded
+// in formats the subscription can't stream.
+type FileIntent string
+
+const (
+	IntentStream   FileIntent = "stream"
+	IntentDownload FileIntent = "download"
 )
 
 const (
@@ -54,35 +65,100 @@ type Client struct {
 
 	baseDir string
 
-	albumTracker *Tracker
-	trackTracker *Tracker
+	store *Store
+
+	albumTracker    *Tracker
+	trackTracker    *Tracker
+	playlistTracker *Tracker
+	goodieTracker   *Tracker
 
 	bundle string
 
-	force bool
+	force  bool
+	resync bool
+	jobs   int
+
+	quality       Quality
+	strictQuality bool
+
+	coverSize int
+	covers    *coverCache
+
+	releases ReleaseFilter
+
+	playlistOutputs []PlaylistOutput
+
+	requestTimeout time.Duration
+	retry          *retrier
+
+	// metadataLimit paces every API request but the file urls, those are
+	// paced by fileURLLimit
+	metadataLimit *limiter
+	fileURLLimit  *limiter
+
+	// purchased holds "album/<id>" and "track/<id>" keys of purchases, their
+	// tracks are requested with the download intent
+	purchased sync.Map
+
+	// lastUpdate holds when the account's favorites, playlists and purchases
+	// last changed, as reported at login
+	lastUpdate userLogin.LastUpdate
+
+	// tracks bounds the number of concurrent track downloads across the client
+	tracks *pool
+
+	// artLocks holds a *sync.Mutex per album directory, several workers can
+	// finish tracks of the same album at once
+	artLocks sync.Map
 
 	AppID   string
 	Secrets []string
 	Header  http.Header
 }
 
-func NewClient(email, password, baseDir string, force bool) (*Client, error) {
+func NewClient(ctx context.Context, email, password string, opts Options) (*Client, error) {
 	headers := http.Header{}
 	headers.Set("User-Agent", userAgent)
 
-	client := &Client{
-		c:            http.DefaultClient,
-		bundle:       "",
-		baseDir:      baseDir,
-		trackTracker: &Tracker{}, //nolint:exhaustruct
-		albumTracker: &Tracker{}, //nolint:exhaustruct
-		force:        force,
-		AppID:        "",
-		Header:       headers,
-		Secrets:      []string{},
+	if opts.Jobs < 1 {
+		opts.Jobs = DefaultJobs
+	}
+
+	if len(opts.Quality) == 0 {
+		opts.Quality = DefaultQuality
+	}
+
+	if len(opts.PlaylistOutputs) == 0 {
+		opts.PlaylistOutputs = DefaultPlaylistOutputs
 	}
 
-	appID, err := client.getAppID()
+	client := &Client{ //nolint:exhaustruct
+		c:             http.DefaultClient,
+		bundle:        "",
+		baseDir:       opts.BaseDir,
+		trackTracker:  &Tracker{}, //nolint:exhaustruct
+		albumTracker:  &Tracker{}, //nolint:exhaustruct
+		force:         opts.Force,
+		resync:        opts.Resync || opts.Force,
+		jobs:          opts.Jobs,
+		tracks:        newPool(opts.Jobs),
+		quality:       opts.Quality,
+		strictQuality: opts.StrictQuality,
+		coverSize:     opts.CoverSize,
+		covers:        newCoverCache(),
+		releases:      opts.Releases,
+
+		playlistOutputs: opts.PlaylistOutputs,
+		requestTimeout:  opts.RequestTimeout,
+		retry:           newRetrier(opts.Retries, opts.RetryBudget),
+		metadataLimit:   newLimiter("metadata", opts.RateLimit),
+		fileURLLimit:    newLimiter("file url", opts.FileURLRateLimit),
+		AppID:           "",
+		Header:          headers,
+		Secrets:         []string{},
+	}
+
+	appID, err := client.getAppID(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "get app id")
 	}
@@ -93,11 +169,11 @@ func NewClient(email, password, baseDir string, force bool) (*Client, error) {
 
 	client.AppID = appID
 
-	if err := client.Login(email, password); err != nil {
+	if err := client.Login(ctx, email, password); err != nil {
 		return nil, errors.Wrap(err, "auth")
 	}
 
-	secrets, err := client.getSecrets()
+	secrets, err := client.getSecrets(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "get secrets")
 	}
@@ -108,25 +184,25 @@ func NewClient(email, password, baseDir string, force bool) (*Client, error) {
 
 	client.Secrets = secrets
 
-	client.trackTracker, err = NewTracker(filepath.Join(baseDir, "tracks.txt"))
+	client.store, err = OpenStore(opts.BaseDir)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to create track tracker")
+		return nil, errors.Wrap(err, "unable to open store")
 	}
 
-	client.albumTracker, err = NewTracker(filepath.Join(baseDir, "albums.txt"))
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to create album tracker")
-	}
+	client.trackTracker = client.store.Tracker(bucketTracks)
+	client.albumTracker = client.store.Tracker(bucketAlbums)
+	client.playlistTracker = client.store.Tracker(bucketPlaylists)
+	client.goodieTracker = client.store.Tracker(bucketGoodies)
 
 	return client, nil
 }
 
-func (client *Client) getBundle() (string, error) {
+func (client *Client) getBundle(ctx context.Context) (string, error) {
 	if client.bundle != "" {
 		return client.bundle, nil
 	}
 
-	bundleURL, err := client.getBundleURL()
+	bundleURL, err := client.getBundleURL(ctx)
 	if err != nil {
 		return "", errors.Wrap(err, "get bundle url")
 	}
@@ -137,7 +213,7 @@ func (client *Client) getBundle() (string, error) {
 		return "", errors.New("invalid bundle url")
 	}
 
-	res, err := http.Get(bundleURL) //nolint:noctx,gosec // We do as much validation as we can above
+	res, err := client.fetch(ctx, bundleURL)
 	if err != nil {
 		return "", errors.Wrap(err, "do request")
 	}
@@ -158,8 +234,8 @@ func (client *Client) getBundle() (string, error) {
 	return client.bundle, nil
 }
 
-func (*Client) getBundleURL() (string, error) {
-	res, err := http.Get(baseApp + "/login") //nolint:noctx
+func (client *Client) getBundleURL(ctx context.Context) (string, error) {
+	res, err := client.fetch(ctx, baseApp+"/login")
 	if err != nil {
 		return "", errors.Wrap(err, "do request")
 	}
@@ -183,8 +259,8 @@ func (*Client) getBundleURL() (string, error) {
 	return baseApp + matches[0][1], nil
 }
 
-func (client *Client) getAppID() (string, error) {
-	bundle, err := client.getBundle()
+func (client *Client) getAppID(ctx context.Context) (string, error) {
+	bundle, err := client.getBundle(ctx)
 	if err != nil {
 		return "", errors.Wrap(err, "get bundle")
 	}
@@ -197,7 +273,7 @@ func (client *Client) getAppID() (string, error) {
 	return matches[0][1], nil
 }
 
-func (client *Client) testSecret(secret string) bool {
+func (client *Client) testSecret(ctx context.Context, secret string) bool {
 	secrets := client.Secrets
 	client.Secrets = []string{secret}
 
@@ -205,8 +281,10 @@ func (client *Client) testSecret(secret string) bool {
 		client.Secrets = secrets
 	}()
 
-	_, err := client.TrackGetFileURL("5966783", QualityMP3)
-	if err != nil && !errors.Is(err, common.ErrUnavailable) {
+	_, err := client.TrackGetFileURL(ctx, "5966783", QualityMP3, IntentStream)
+	// a restricted track still proves the signature was accepted
+	if err != nil && !errors.Is(err, common.ErrUnavailable) &&
+		!errors.Is(err, common.ErrGeoRestricted) && !errors.Is(err, common.ErrSubscriptionRequired) {
 		if !errors.Is(err, common.ErrBadRequest) {
 			log.Debug().Err(err).Msg("unexpected error when testing secrets")
 		}
@@ -218,8 +296,8 @@ func (client *Client) testSecret(secret string) bool {
 }
 
 //nolint:cyclop,funlen // todo: fix in future
-func (client *Client) getSecrets() ([]string, error) {
-	bundle, err := client.getBundle()
+func (client *Client) getSecrets(ctx context.Context) ([]string, error) {
+	bundle, err := client.getBundle(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "get bundle")
 	}
@@ -276,7 +354,7 @@ func (client *Client) getSecrets() ([]string, error) {
 			return nil, errors.Wrap(err, "decode secret")
 		}
 
-		if client.testSecret(string(base64Secret)) {
+		if client.testSecret(ctx, string(base64Secret)) {
 			secrets = append(secrets, string(base64Secret))
 		}
 	}
@@ -284,8 +362,8 @@ func (client *Client) getSecrets() ([]string, error) {
 	return secrets, nil
 }
 
-func (client *Client) Login(email, password string) error {
-	login, err := (Querier[userLogin.Response]{client}).Req("user/login", &url.Values{
+func (client *Client) Login(ctx context.Context, email, password string) error {
+	login, err := (Querier[userLogin.Response]{client}).Req(ctx, "user/login", &url.Values{
 		"email":    {email},
 		"password": {password},
 		"app_id":   {client.AppID},
@@ -299,17 +377,14 @@ func (client *Client) Login(email, password string) error {
 	}
 
 	client.Header.Set(userAuthToken, login.UserAuthToken)
+	client.lastUpdate = login.User.LastUpdate
 
 	return nil
 }
 
 func (client *Client) Close() error {
-	if err := client.trackTracker.Close(); err != nil {
-		return errors.Wrap(err, "unable to close track tracker")
-	}
-
-	if err := client.albumTracker.Close(); err != nil {
-		return errors.Wrap(err, "unable to close album tracker")
+	if err := client.store.Close(); err != nil {
+		return errors.Wrap(err, "unable to close store")
 	}
 
 	return nil
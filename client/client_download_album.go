@@ -1,17 +1,23 @@
 package client
 
 import (
+	"context"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/helpers"
 	"github.com/trevorstarick/qobuz-sync/responses"
 )
 
-func (client *Client) downloadAlbumTrack(track *responses.Track, album *responses.Album) error {
+func (client *Client) downloadAlbumTrack(ctx context.Context, track *responses.Track, album *responses.Album) error {
 	if track.Album == nil {
 		track.Album = album
 	}
@@ -29,7 +35,7 @@ func (client *Client) downloadAlbumTrack(track *responses.Track, album *response
 		return nil
 	}
 
-	err = client.downloadTrack(strconv.Itoa(track.ID))
+	err = client.downloadTrack(ctx, strconv.Itoa(track.ID))
 	if err != nil {
 		if errors.Is(err, common.ErrAlreadyExists) {
 			log.Info().Msgf("track already exists, skipping: %v", track.Path())
@@ -43,19 +49,33 @@ func (client *Client) downloadAlbumTrack(track *responses.Track, album *response
 	return nil
 }
 
-func (client *Client) downloadAlbum(albumID string) (*responses.Album, error) {
-	if !client.force {
-		_, err := client.albumTracker.Get(albumID)
+func (client *Client) downloadAlbum(ctx context.Context, albumID string) (*responses.Album, error) {
+	// purchased albums are always gone through, an album downloaded before it
+	// was bought still lacks the tracks that weren't streamable
+	_, purchased := client.purchased.Load("album/" + albumID)
+
+	if !client.force && !purchased {
+		dir, err := client.albumTracker.Get(albumID)
 		if err == nil {
+			if err := client.backfillGoodies(ctx, albumID, dir); err != nil {
+				return nil, errors.Wrap(err, "failed to backfill goodies")
+			}
+
 			return nil, errors.Wrap(common.ErrAlreadyExists, "cached")
 		}
 	}
 
-	album, err := client.AlbumGet(albumID)
+	album, err := client.AlbumGet(ctx, albumID)
 	if err != nil {
 		return nil, errors.Wrap(err, "album get")
 	}
 
+	if purchased {
+		for _, track := range album.Tracks.Items {
+			client.purchased.Store("track/"+strconv.Itoa(track.ID), true)
+		}
+	}
+
 	albumDir := filepath.Join(client.baseDir, album.Path())
 
 	err = os.MkdirAll(albumDir, common.DirPerm)
@@ -63,14 +83,41 @@ func (client *Client) downloadAlbum(albumID string) (*responses.Album, error) {
 		return nil, errors.Wrap(err, "failed to create directory")
 	}
 
+	logger := log.With().Str("album", albumID).Logger()
+
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Int32
+	)
+
 	for i := range album.Tracks.Items {
-		err = client.downloadAlbumTrack(&album.Tracks.Items[i], album.Album)
-		if err != nil {
-			path := album.Tracks.Items[i].Path()
-			log.Error().Err(err).Msgf("failed to download track, skipping: %v", path)
+		track := &album.Tracks.Items[i]
+
+		client.tracks.Go(ctx, &wg, func() {
+			err := client.downloadAlbumTrack(ctx, track, album.Album)
+			if err != nil {
+				failed.Add(1)
+				logger.Error().Err(err).Msgf("failed to download track, skipping: %v", track.Path())
+			}
+		})
+	}
 
-			continue
-		}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "album download cancelled")
+	}
+
+	// an album with missing tracks isn't marked as downloaded, so the next
+	// run retries it
+	if n := failed.Load(); n > 0 {
+		return nil, errors.Errorf("%d of %d tracks failed: %v", n, len(album.Tracks.Items), album.Path())
+	}
+
+	// like tracks, failed goodies keep the album from being marked as
+	// downloaded
+	if err := client.downloadGoodies(ctx, album.Album, albumDir); err != nil {
+		return nil, err
 	}
 
 	if album.Downloadable {
@@ -79,14 +126,14 @@ func (client *Client) downloadAlbum(albumID string) (*responses.Album, error) {
 			return nil, errors.Wrap(err, "failed to set album as downloaded")
 		}
 	} else {
-		log.Info().Msgf("album not released yet, not setting as downloaded: %v", album.Path())
+		logger.Info().Msgf("album not released yet, not setting as downloaded: %v", album.Path())
 	}
 
 	return album.Album, nil
 }
 
-func (client *Client) DownloadAlbum(albumID string) error {
-	album, err := client.downloadAlbum(albumID)
+func (client *Client) DownloadAlbum(ctx context.Context, albumID string) error {
+	album, err := client.downloadAlbum(ctx, albumID)
 	if err != nil {
 		if errors.Is(err, common.ErrAlreadyExists) {
 			dir, _ := client.albumTracker.Get(albumID)
@@ -104,10 +151,10 @@ func (client *Client) DownloadAlbum(albumID string) error {
 
 	albumDir := filepath.Join(client.baseDir, album.Path())
 
-	err = album.DownloadAlbumArt(albumDir)
+	err = client.downloadAlbumArt(ctx, album, albumDir)
 	if err != nil {
 		if errors.Is(err, common.ErrAlreadyExists) {
-			log.Info().Msgf("album art already exists, skipping: %v/album.jpg", album.Path())
+			log.Info().Msgf("album art already exists, skipping: %v", album.Path())
 		} else {
 			log.Warn().Msgf("failed to download album art, skipping: %v", err)
 		}
@@ -117,3 +164,66 @@ func (client *Client) DownloadAlbum(albumID string) error {
 
 	return nil
 }
+
+// albumArtNames are the files album art is saved as, by its type.
+//
+//nolint:gochecknoglobals
+var albumArtNames = map[string]string{
+	helpers.MimeJPEG: "album.jpg",
+	helpers.MimePNG:  "album.png",
+}
+
+// downloadAlbumArt saves the album's original cover into dir, named after its
+// type. Workers on the same album wait for each other, other albums aren't
+// held up.
+func (client *Client) downloadAlbumArt(ctx context.Context, album *responses.Album, dir string) error {
+	lock, _ := client.artLocks.LoadOrStore(dir, &sync.Mutex{})
+	mu := lock.(*sync.Mutex) //nolint:forcetypeassert // only mutexes are stored
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := os.MkdirAll(dir, common.DirPerm); err != nil {
+		return errors.Wrap(err, "failed to create dir")
+	}
+
+	for _, name := range albumArtNames {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return common.ErrAlreadyExists
+		}
+	}
+
+	url := album.OriginalImageURL()
+	log.Debug().Str("url", url).Str("dir", dir).Msg("downloading album art")
+
+	// do some basic verification that the url is valid
+	if !strings.HasPrefix(url, "https://static.qobuz.com/images/covers/") {
+		return errors.New("invalid album art url")
+	}
+
+	res, err := client.fetch(ctx, url)
+	if err != nil {
+		return errors.Wrap(err, "failed to get album art")
+	}
+
+	defer res.Body.Close()
+
+	got, body, err := helpers.Sniff(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to sniff album art")
+	}
+
+	name, ok := albumArtNames[got]
+	if !ok {
+		return &common.ContentError{
+			Expected: []string{helpers.MimeJPEG, helpers.MimePNG},
+			Got:      got,
+		}
+	}
+
+	return writeFileAtomic(filepath.Join(dir, name), func(w io.Writer) error {
+		_, err := io.Copy(w, body)
+
+		return errors.Wrap(err, "failed to copy response body")
+	})
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/responses"
+)
+
+// artistReleases pages through the artist's discography and returns the
+// releases matching the client's release filter.
+func (client *Client) artistReleases(ctx context.Context, artistID string) (*responses.Artist, []responses.Album, error) {
+	var (
+		artist   *responses.Artist
+		releases = make([]responses.Album, 0)
+		pages    = client.ArtistGet(ctx, artistID)
+	)
+
+	for pages.Next() {
+		res := pages.Page()
+		artist = res.Artist
+
+		for i := range res.Albums.Items {
+			album := &res.Albums.Items[i]
+
+			if client.releases.Match(album, artist.ID) {
+				releases = append(releases, *album)
+			} else {
+				log.Debug().Msgf("release filtered out: %v", album.Path())
+			}
+		}
+	}
+
+	if err := pages.Err(); err != nil {
+		return nil, nil, errors.Wrap(err, "unable to get artist")
+	}
+
+	return artist, releases, nil
+}
+
+// dedupeReleases keeps a single edition of the releases sharing a title, the
+// one with the best bit depth and then sampling rate. The order of first
+// appearance is kept.
+func dedupeReleases(releases []responses.Album) []responses.Album {
+	var (
+		best  = make(map[string]int)
+		order = make([]string, 0, len(releases))
+	)
+
+	for i, release := range releases {
+		key := strings.ToLower(strings.TrimSpace(release.Title))
+
+		j, ok := best[key]
+		if !ok {
+			best[key] = i
+			order = append(order, key)
+
+			continue
+		}
+
+		current := releases[j]
+		if release.MaximumBitDepth > current.MaximumBitDepth ||
+			(release.MaximumBitDepth == current.MaximumBitDepth &&
+				release.MaximumSamplingRate > current.MaximumSamplingRate) {
+			best[key] = i
+		}
+	}
+
+	deduped := make([]responses.Album, 0, len(order))
+	for _, key := range order {
+		deduped = append(deduped, releases[best[key]])
+	}
+
+	return deduped
+}
+
+// DownloadArtist downloads the artist's discography, see Options.Releases.
+func (client *Client) DownloadArtist(ctx context.Context, artistID string) error {
+	artist, releases, err := client.artistReleases(ctx, artistID)
+	if err != nil {
+		if errors.Is(err, common.ErrNotFound) {
+			log.Warn().Msgf("artist not found: %v", artistID)
+
+			return nil
+		}
+
+		return err
+	}
+
+	releases = dedupeReleases(releases)
+
+	log.Info().Msgf("downloading %d releases of %v", len(releases), artist.Name)
+
+	var (
+		wg     sync.WaitGroup
+		albums = newPool(client.jobs)
+		failed atomic.Int32
+	)
+
+	for i := range releases {
+		album := &releases[i]
+
+		albums.Go(ctx, &wg, func() {
+			if !client.downloadAlbumAndArt(ctx, album) {
+				failed.Add(1)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "artist download cancelled")
+	}
+
+	if n := failed.Load(); n > 0 {
+		return errors.Errorf("%d of %d releases failed: %v", n, len(releases), artist.Name)
+	}
+
+	log.Info().Msgf("downloaded artist: %v", artist.Name)
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/responses"
+)
+
+// LabelFilter picks the albums downloaded from a label's catalog, zero values
+// don't filter.
+type LabelFilter struct {
+	Since  time.Time
+	Until  time.Time
+	Genres []string
+}
+
+// labelCheckpoint is stored per label after a run without failures so that the
+// next run only downloads what was added since.
+type labelCheckpoint struct {
+	// Filter is the filter of the run, a different filter starts over
+	Filter string `json:"filter"`
+	// AddedAt is the newest album of the catalog, see albumAddedAt
+	AddedAt   int       `json:"added_at"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// albumAddedAt is when the album appeared on Qobuz, falling back to its
+// release date for listings that leave created_at out.
+func albumAddedAt(album *responses.Album) int {
+	return max(album.CreatedAt, album.ReleasedAt)
+}
+
+func albumReleaseDate(album *responses.Album) time.Time {
+	if album.ReleasedAt != 0 {
+		return time.Unix(int64(album.ReleasedAt), 0)
+	}
+
+	date, err := time.Parse(time.DateOnly, album.ReleaseDateOriginal)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return date
+}
+
+func (filter LabelFilter) Match(album *responses.Album) bool {
+	date := albumReleaseDate(album)
+
+	if !filter.Since.IsZero() && date.Before(filter.Since) {
+		return false
+	}
+
+	if !filter.Until.IsZero() && date.After(filter.Until) {
+		return false
+	}
+
+	if len(filter.Genres) == 0 {
+		return true
+	}
+
+	genres := append(album.Genres(), album.Genre.Name)
+
+	return slices.ContainsFunc(filter.Genres, func(want string) bool {
+		return slices.ContainsFunc(genres, func(genre string) bool {
+			return strings.EqualFold(genre, want)
+		})
+	})
+}
+
+func (filter LabelFilter) String() string {
+	genres := make([]string, 0, len(filter.Genres))
+	for _, genre := range filter.Genres {
+		genres = append(genres, strings.ToLower(genre))
+	}
+
+	slices.Sort(genres)
+
+	return fmt.Sprintf("since=%v until=%v genres=%v",
+		filter.Since.Format(time.DateOnly), filter.Until.Format(time.DateOnly), strings.Join(genres, ","))
+}
+
+// DownloadLabel downloads the label's catalog. Unless the client resyncs,
+// only the albums added since the last complete run with the same filter are
+// considered.
+//
+//nolint:cyclop,funlen // TODO: refactor
+func (client *Client) DownloadLabel(ctx context.Context, labelID string, filter LabelFilter) error {
+	var checkpoint labelCheckpoint
+
+	found, err := client.store.get(bucketLabels, labelID, &checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "unable to get label checkpoint")
+	}
+
+	if found && (client.resync || checkpoint.Filter != filter.String()) {
+		found = false
+	}
+
+	var (
+		wg     sync.WaitGroup
+		albums = newPool(client.jobs)
+		failed atomic.Int32
+
+		name    string
+		newest  = 0
+		queued  = 0
+		skipped = 0
+		pages   = client.LabelGet(ctx, labelID)
+	)
+
+	for pages.Next() {
+		res := pages.Page()
+		name = res.Name
+
+		for i := range res.Albums.Items {
+			album := &res.Albums.Items[i]
+			newest = max(newest, albumAddedAt(album))
+
+			if found && albumAddedAt(album) <= checkpoint.AddedAt {
+				skipped++
+
+				continue
+			}
+
+			if !filter.Match(album) {
+				log.Debug().Msgf("album filtered out: %v", album.Path())
+
+				continue
+			}
+
+			queued++
+
+			albums.Go(ctx, &wg, func() {
+				if !client.downloadAlbumAndArt(ctx, album) {
+					failed.Add(1)
+				}
+			})
+		}
+	}
+
+	wg.Wait()
+
+	// albums dropped by the pool never ran, saving the checkpoint would
+	// skip them for good
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "label download cancelled")
+	}
+
+	if err := pages.Err(); err != nil {
+		if errors.Is(err, common.ErrNotFound) {
+			log.Warn().Msgf("label not found: %v", labelID)
+
+			return nil
+		}
+
+		return errors.Wrap(err, "unable to get label")
+	}
+
+	log.Info().Msgf("label %v: %d albums queued, %d seen in a previous run", name, queued, skipped)
+
+	if n := failed.Load(); n > 0 {
+		return errors.Errorf("%d of %d albums of %v failed, not updating the checkpoint", n, queued, name)
+	}
+
+	err = client.store.put(bucketLabels, labelID, labelCheckpoint{
+		Filter:    filter.String(),
+		AddedAt:   newest,
+		CheckedAt: time.Now(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to save label checkpoint")
+	}
+
+	return nil
+}
@@ -1,9 +1,11 @@
 package client
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
@@ -11,12 +13,46 @@ import (
 	"github.com/trevorstarick/qobuz-sync/helpers"
 )
 
-func (client *Client) DownloadPlaylist(playlistID string) error {
-	res, err := client.PlaylistGet(playlistID)
+// DownloadPlaylist syncs a playlist. A playlist whose updated_at didn't change
+// since the last sync is skipped, otherwise the tracks added, removed and
+// reordered are reported and only the tracks not on disk yet are downloaded.
+//
+//nolint:cyclop,funlen // TODO: refactor
+func (client *Client) DownloadPlaylist(ctx context.Context, playlistID string, mirror MirrorOptions) error {
+	previous, synced, err := client.loadPlaylistState(playlistID)
+	if err != nil {
+		return err
+	}
+
+	if synced && previous.UpdatedAt != 0 && !client.resync {
+		info, err := client.PlaylistGetInfo(ctx, playlistID)
+		if err != nil {
+			return errors.Wrap(err, "playlist get")
+		}
+
+		_, err = client.playlistTracker.Get(playlistID)
+		if err == nil && info.UpdatedAt == previous.UpdatedAt {
+			log.Info().Msgf("playlist unchanged: %v", info.Name)
+
+			return nil
+		}
+	}
+
+	res, err := client.PlaylistGet(ctx, playlistID)
 	if err != nil {
 		return errors.Wrap(err, "playlist get")
 	}
 
+	current := newPlaylistState(res.UpdatedAt, res.Tracks.Items)
+
+	var diff playlistDiff
+	if synced {
+		diff = diffPlaylist(previous, current)
+
+		log.Info().Msgf("playlist %v: %d added, %d removed, %d reordered",
+			res.Name, len(diff.Added), len(diff.Removed), diff.Reordered)
+	}
+
 	playlistDir := filepath.Join(client.baseDir, "_playlist", helpers.SanitizeStringToPath(res.Name))
 
 	err = os.MkdirAll(playlistDir, common.DirPerm)
@@ -24,48 +60,150 @@ func (client *Client) DownloadPlaylist(playlistID string) error {
 		return errors.Wrap(err, "failed to create playlist dir")
 	}
 
-	m3uFile, err := os.Create(filepath.Join(playlistDir, "playlist.m3u"))
-	if err != nil {
-		return errors.Wrap(err, "failed to create m3u file")
+	var wg sync.WaitGroup
+
+	// tracks already on disk are skipped by downloadTrack, so only the added
+	// ones and the ones that failed before are fetched
+	results := make([]error, len(res.Tracks.Items))
+
+	for i := range res.Tracks.Items {
+		trackID := strconv.Itoa(res.Tracks.Items[i].ID)
+
+		client.tracks.Go(ctx, &wg, func() {
+			results[i] = client.downloadTrack(ctx, trackID)
+		})
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "playlist download cancelled")
 	}
 
-	defer func() {
-		if syncErr := m3uFile.Sync(); syncErr != nil {
-			err = errors.Wrap(err, "failed to sync m3u file")
+	entries := make([]playlistEntry, 0, len(res.Tracks.Items))
+
+	for i := range res.Tracks.Items {
+		track := &res.Tracks.Items[i]
+		trackID := strconv.Itoa(track.ID)
+
+		if err := results[i]; err != nil && !errors.Is(err, common.ErrAlreadyExists) {
+			log.Warn().Err(err).Msgf("failed to download track, leaving it out of the playlist: %v", trackID)
+
+			continue
 		}
 
-		if closeErr := m3uFile.Close(); closeErr != nil {
-			err = errors.Wrap(err, "failed to close m3u file")
+		path, err := client.trackTracker.Get(trackID)
+		if err != nil {
+			log.Warn().Err(err).Msgf("track not on disk, leaving it out of the playlist: %v", trackID)
+
+			continue
 		}
-	}()
 
-	_, _ = m3uFile.WriteString("#EXTM3U\n")
-	_, _ = m3uFile.WriteString("#EXTENC: UTF-8\n")
-	_, _ = m3uFile.WriteString("#PLAYLIST: " + res.Name + "\n")
-	_, _ = m3uFile.WriteString("#EXTID: " + playlistID + "\n")
+		entries = append(entries, playlistEntry{Track: track, Path: path, Location: ""})
+	}
+
+	// without its updated_at the next run syncs the playlist again even if
+	// it didn't change, and retries the missing tracks
+	if len(entries) < len(res.Tracks.Items) {
+		current.UpdatedAt = 0
+	}
+
+	// the playlist is written once every track has finished so it keeps the
+	// playlist order no matter which download completed first
+	sortPlaylistEntries(entries)
+
+	playlist := playlistFile{
+		ID:      playlistID,
+		Name:    res.Name,
+		Owner:   res.Owner.Name,
+		Entries: entries,
+	}
 
-	for _, track := range res.Tracks.Items {
-		err = client.downloadTrack(strconv.Itoa(track.ID))
+	paths := make([]string, 0, len(client.playlistOutputs))
+
+	for _, output := range client.playlistOutputs {
+		path, err := writePlaylist(playlistDir, playlist, output)
 		if err != nil {
-			if errors.Is(err, common.ErrAlreadyExists) {
-				path, _ := client.trackTracker.Get(strconv.Itoa(track.ID))
-				log.Info().Msgf("track already exists, skipping: %v", path)
+			return errors.Wrapf(err, "failed to write %v playlist", output.Format)
+		}
+
+		paths = append(paths, path)
+	}
+
+	err = client.writePlaylistCover(ctx, res, playlistDir)
+	if err != nil {
+		if errors.Is(err, common.ErrAlreadyExists) {
+			log.Info().Msgf("playlist cover up to date: %v/%v", playlistDir, playlistCoverFile)
+		} else {
+			log.Warn().Err(err).Msgf("unable to write playlist cover, skipping: %v", playlistDir)
+		}
+	}
 
-				_, _ = m3uFile.WriteString("#EXTINF:" + strconv.Itoa(track.Duration) + "," + track.Album.Artist.Name + " - " + track.Title + "\n") //nolint:lll // m3u format
+	err = client.playlistTracker.SetEntry(playlistID, TrackerEntry{ //nolint:exhaustruct
+		Path: paths[0],
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to set playlist as downloaded")
+	}
+
+	log.Info().Msgf("downloaded playlist: %v", playlistDir)
 
-				relPath, err := filepath.Rel(playlistDir, path)
-				if err != nil {
-					return errors.Wrap(err, "failed to get relative path")
-				}
+	return client.mirrorPlaylist(playlistID, current, diff.Removed, mirror)
+}
+
+// mirrorPlaylist saves the playlist's state and, when mirroring, archives or
+// deletes the removed tracks. Otherwise they are left on disk.
+func (client *Client) mirrorPlaylist(playlistID string, current playlistState, removed []playlistStateTrack, mirror MirrorOptions) error {
+	switch {
+	case len(removed) == 0:
+	case mirror.Enabled:
+		usage, err := client.loadTrackUsage()
+		if err != nil {
+			return err
+		}
 
-				_, _ = m3uFile.WriteString(relPath + "\n")
-			} else {
-				log.Warn().Err(err).Msgf("failed to download track, skipping: %v", strconv.Itoa(track.ID))
+		dropped := make([]mirrorItem, 0, len(removed))
+
+		for _, track := range removed {
+			// the same track may still be in another slot
+			if current.contains(track.TrackID) {
+				continue
+			}
+
+			if item := droppedTrack(usage, track.TrackID, false, playlistID); item != nil {
+				dropped = append(dropped, *item)
 			}
 		}
+
+		err = client.applyMirror(mirror, usage, dropped, func(mirrorItem) {})
+		if err != nil {
+			return err
+		}
+
+		// a dry run leaves the previous state so the next run still sees
+		// what was removed
+		if mirror.DryRun {
+			return nil
+		}
+	default:
+		log.Info().Msgf("leaving %d removed tracks on disk, use --mirror to archive them", len(removed))
 	}
 
-	log.Info().Msgf("downloaded playlist: %v", playlistDir)
+	return client.savePlaylistState(playlistID, current)
+}
+
+// AllPlaylists syncs every playlist the user owns or follows.
+func (client *Client) AllPlaylists(ctx context.Context, mirror MirrorOptions) error {
+	pages := client.PlaylistGetUserPlaylists(ctx)
+
+	for pages.Next() {
+		for _, playlist := range pages.Page().Playlists.Items {
+			err := client.DownloadPlaylist(ctx, strconv.Itoa(playlist.ID), mirror)
+			if err != nil {
+				log.Warn().Err(err).Msgf("unable to sync playlist, skipping: %v", playlist.Name)
+			}
+		}
+	}
 
-	return nil
+	return errors.Wrap(pages.Err(), "failed to get user playlists")
 }
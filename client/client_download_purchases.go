@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Purchases downloads every purchased album and track. Their files are
+// requested with the download intent and purchased albums come with their
+// goodies.
+func (client *Client) Purchases(ctx context.Context) error {
+	var (
+		wg     sync.WaitGroup
+		albums = newPool(client.jobs)
+		failed atomic.Int32
+		count  = 0
+		pages  = client.PurchaseGetUserPurchases(ctx, ListTypeALBUM)
+	)
+
+	for pages.Next() {
+		res := pages.Page()
+
+		for i := range res.Albums.Items {
+			album := &res.Albums.Items[i]
+			client.purchased.Store("album/"+album.ID, true)
+			count++
+
+			albums.Go(ctx, &wg, func() {
+				if !client.downloadAlbumAndArt(ctx, album) {
+					failed.Add(1)
+				}
+			})
+		}
+	}
+
+	if err := pages.Err(); err != nil {
+		wg.Wait()
+
+		return errors.Wrap(err, "unable to get purchased albums")
+	}
+
+	tracks := client.PurchaseGetUserPurchases(ctx, ListTypeTRACK)
+
+	for tracks.Next() {
+		res := tracks.Page()
+
+		for i := range res.Tracks.Items {
+			track := &res.Tracks.Items[i]
+			client.purchased.Store("track/"+strconv.Itoa(track.ID), true)
+			count++
+
+			client.tracks.Go(ctx, &wg, func() {
+				if !client.downloadTrackAndArt(ctx, track) {
+					failed.Add(1)
+				}
+			})
+		}
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "purchases cancelled")
+	}
+
+	if err := tracks.Err(); err != nil {
+		return errors.Wrap(err, "unable to get purchased tracks")
+	}
+
+	if n := failed.Load(); n > 0 {
+		return errors.Errorf("%d of %d purchases failed", n, count)
+	}
+
+	log.Info().Msgf("processed %d purchases", count)
+
+	return nil
+}
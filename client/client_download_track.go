@@ -1,50 +1,329 @@
 package client
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/helpers"
+	trackGetFileUrl "github.com/trevorstarick/qobuz-sync/responses/track/getFileUrl"
 )
 
+const (
+	// partMaxAge is how old a .part file can be before it is thrown away
+	// instead of being resumed
+	partMaxAge = 24 * time.Hour
+
+	// maxResumeAttempts is how many times an expired url is refreshed or a
+	// stale partial file restarted
+	maxResumeAttempts = 3
+)
+
+var (
+	errStreamExpired = errors.New("streaming url expired")
+	errStalePart     = errors.New("partial file does not match remote file")
+)
+
+// downloadFile downloads the track to path with its extension swapped for
+// the delivered format and returns the format and the path that was written.
+// An existing file is only replaced when overwrite is set. Interrupted
+// transfers are resumed, unless ctx is done: the partial file is removed then.
+// url is the file url to start from, nil asks Qobuz for one.
+//
 //nolint:cyclop // TODO: refactor
-func (client *Client) downloadFile(trackID, path string) error {
-	url, err := client.TrackGetFileURL(trackID, QualityMAX)
+func (client *Client) downloadFile(
+	ctx context.Context, trackID, path string, url *trackGetFileUrl.Response, overwrite bool,
+) (*trackGetFileUrl.Response, string, error) {
+	var err error
+
+	if url == nil {
+		url, err = client.trackFileURL(ctx, trackID)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "failed to get track file url")
+		}
+	}
+
+	path = withExtension(path, TrackFormat(url.FormatID).Extension())
+
+	if _, err := os.Stat(strings.TrimSuffix(path, ".part")); err == nil && !overwrite {
+		return url, path, errors.Wrap(common.ErrAlreadyExists, "cached")
+	}
+
+	streamURL := url.URL
+
+	for attempt := 1; ; attempt++ {
+		if streamExpired(streamURL) {
+			refreshed, err := client.trackFileURL(ctx, trackID)
+			if err != nil {
+				return nil, "", errors.Wrap(err, "failed to refresh track file url")
+			}
+
+			if refreshed.FormatID != url.FormatID {
+				// the bytes on disk belong to the old format and can't be
+				// resumed, the new format starts over from the first byte
+				log.Warn().Msgf("format changed from %v to %v while resuming, restarting: %v",
+					TrackFormat(url.FormatID), TrackFormat(refreshed.FormatID), path)
+
+				client.removePart(path)
+				path = withExtension(path, TrackFormat(refreshed.FormatID).Extension())
+			}
+
+			url, streamURL = refreshed, refreshed.URL
+		}
+
+		err = client.fetchFile(ctx, streamURL, path, url.MimeType, url.FormatID)
+		if err == nil {
+			client.forgetPart(path)
+
+			return url, path, nil
+		}
+
+		if ctx.Err() != nil {
+			client.removePart(path)
+
+			return nil, "", errors.Wrap(ctx.Err(), "download cancelled")
+		}
+
+		if errors.Is(err, common.ErrInvalidContent) {
+			return nil, "", err
+		}
+
+		switch {
+		case errors.Is(err, errStreamExpired) && attempt < maxResumeAttempts:
+			log.Debug().Msgf("streaming url expired, refreshing: %v", path)
+
+			streamURL = ""
+		case errors.Is(err, errStalePart) && attempt < maxResumeAttempts:
+			log.Warn().Msgf("partial download is stale, restarting: %v", path)
+
+			if err := os.Remove(path); err != nil {
+				return nil, "", errors.Wrap(err, "failed to remove stale part file")
+			}
+		default:
+			// the partial file is kept for the next run unless the run was
+			// cancelled while waiting
+			if err := client.retry.backoff(ctx, attempt, err); err != nil {
+				if ctx.Err() != nil {
+					client.removePart(path)
+				}
+
+				return nil, "", err
+			}
+
+			log.Warn().Err(err).Msgf("download interrupted, resuming: %v", path)
+		}
+	}
+}
+
+// removePart deletes a partial download, it may not exist yet.
+func (client *Client) removePart(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Warn().Err(err).Msgf("failed to remove partial file: %v", path)
+	}
+
+	client.forgetPart(path)
+}
+
+// partInfo ties a .part file to the stream it is the start of, a part of
+// another format or of a file with another size can't be resumed.
+type partInfo struct {
+	FormatID int `json:"format_id"`
+	// Size is the length of the whole file, 0 when the server didn't say
+	Size int64 `json:"size"`
+}
+
+func (client *Client) forgetPart(path string) {
+	if err := client.store.delete(bucketParts, path); err != nil {
+		log.Warn().Err(err).Msgf("failed to forget partial file: %v", path)
+	}
+}
+
+// withExtension replaces the audio extension of path, keeping a trailing
+// .part suffix in place.
+func withExtension(path, ext string) string {
+	part := strings.HasSuffix(path, ".part")
+	path = strings.TrimSuffix(path, ".part")
+	path = strings.TrimSuffix(path, filepath.Ext(path)) + ext
+
+	if part {
+		path += ".part"
+	}
+
+	return path
+}
+
+// streamExpired reports whether a streaming url has to be refreshed. Qobuz
+// signs the urls with an expiry timestamp in the etsp parameter.
+func streamExpired(streamURL string) bool {
+	if streamURL == "" {
+		return true
+	}
+
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return false
+	}
+
+	etsp, err := strconv.ParseInt(u.Query().Get("etsp"), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return time.Now().Unix() >= etsp
+}
+
+// partOffset returns the number of bytes already on disk for path and what
+// they are the start of. Partial files that are too old or of another format,
+// or that predate partInfo, are removed and restarted from zero.
+func (client *Client) partOffset(path string, formatID int) (int64, partInfo, error) {
+	var part partInfo
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, part, nil
+		}
+
+		return 0, part, errors.Wrap(err, "failed to stat part file")
+	}
+
+	found, err := client.store.get(bucketParts, path, &part)
 	if err != nil {
-		return errors.Wrap(err, "failed to get track file url")
+		return 0, part, errors.Wrap(err, "failed to get part info")
 	}
 
-	if url.MimeType != "audio/flac" {
-		log.Warn().Msgf("not FLAC got %v: %v", url.MimeType, path)
-		path = strings.ReplaceAll(path, ".flac", ".mp3")
+	switch {
+	case time.Since(stat.ModTime()) > partMaxAge:
+		log.Debug().Msgf("partial download too old, restarting: %v", path)
+	case !found || part.FormatID != formatID:
+		log.Debug().Msgf("partial download of another format, restarting: %v", path)
+	default:
+		return stat.Size(), part, nil
+	}
+
+	if err := os.Remove(path); err != nil {
+		return 0, part, errors.Wrap(err, "failed to remove stale part file")
+	}
+
+	return 0, part, nil
+}
+
+// checkAudioContent fails unless the sniffed content type is an audio format
+// and logs when it doesn't match what Qobuz declared.
+func checkAudioContent(got, declared, path string) error {
+	if got != helpers.MimeFLAC && got != helpers.MimeMP3 {
+		return &common.ContentError{
+			Expected: []string{helpers.MimeFLAC, helpers.MimeMP3},
+			Got:      got,
+		}
 	}
 
-	if _, err := os.Stat(strings.TrimSuffix(path, ".part")); err == nil {
-		return errors.Wrap(common.ErrAlreadyExists, "cached")
+	if got != declared {
+		log.Warn().Msgf("qobuz declared %v but sent %v: %v", declared, got, path)
 	}
 
+	return nil
+}
+
+//nolint:cyclop,funlen // TODO: refactor
+func (client *Client) fetchFile(ctx context.Context, streamURL, path, mimeType string, formatID int) error {
 	// do some basic verification that the url is valid
-	if !strings.HasPrefix(url.URL, "https://streaming-qobuz-std.akamaized.net/file?") {
+	if !strings.HasPrefix(streamURL, "https://streaming-qobuz-std.akamaized.net/file?") {
 		return errors.New("was given an invalid streaming url from qobuz")
 	}
 
-	res, err := http.Get(url.URL) //nolint:noctx
+	offset, part, err := client.partOffset(path, formatID)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, streamURL, http.NoBody)
 	if err != nil {
-		return errors.Wrap(err, "failed to do request")
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	res, err := client.do(req)
+	if err != nil {
+		return err
 	}
 
 	defer func() {
 		if closeErr := res.Body.Close(); closeErr != nil {
-			err = errors.Wrap(err, "failed to close m3u file")
+			err = errors.Wrap(err, "failed to close response body")
 		}
 	}()
 
-	audioFile, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, common.FilePerm)
+	flags := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		if offset > 0 {
+			log.Debug().Msgf("server ignored range request, restarting: %v", path)
+		}
+
+		err := client.store.put(bucketParts, path, partInfo{FormatID: formatID, Size: max(res.ContentLength, 0)})
+		if err != nil {
+			return errors.Wrap(err, "failed to save part info")
+		}
+	case http.StatusPartialContent:
+		// the part must be the start of this very file, the same offset
+		// into a file of another size is another stream
+		start, total, err := contentRange(res.Header.Get("Content-Range"))
+		if err != nil || start != offset || (part.Size > 0 && total != part.Size) {
+			return errStalePart
+		}
+
+		log.Info().Msgf("resuming download at %d bytes: %v", offset, path)
+
+		flags = os.O_WRONLY | os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		return errStalePart
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusGone:
+		return errStreamExpired
+	default:
+		return statusError(res)
+	}
+
+	var (
+		body = io.Reader(res.Body)
+		got  string
+	)
+
+	// validate the signature before anything is written, when resuming the
+	// start of the stream is already on disk
+	if flags&os.O_APPEND == 0 {
+		got, body, err = helpers.Sniff(res.Body)
+	} else {
+		got, err = helpers.SniffFile(path)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to sniff content")
+	}
+
+	if err := checkAudioContent(got, mimeType, path); err != nil {
+		if removeErr := os.Remove(path); removeErr != nil && !os.IsNotExist(removeErr) {
+			log.Warn().Err(removeErr).Msgf("failed to remove partial file: %v", path)
+		}
+
+		return err
+	}
+
+	audioFile, err := os.OpenFile(path, flags, common.FilePerm)
 	if err != nil {
 		return errors.Wrap(err, "failed to create file")
 	}
@@ -59,7 +338,7 @@ func (client *Client) downloadFile(trackID, path string) error {
 		}
 	}()
 
-	_, err = io.Copy(audioFile, res.Body)
+	_, err = io.Copy(audioFile, body)
 	if err != nil {
 		return errors.Wrap(err, "failed to copy response body")
 	}
@@ -67,24 +346,43 @@ func (client *Client) downloadFile(trackID, path string) error {
 	return nil
 }
 
-func (client *Client) downloadFileAndSetMetadata(trackID, path string, metadata common.Metadata) error {
-	partialPath := path + ".part"
+// contentRange parses the first byte position and the total length out of a
+// "bytes start-end/total" Content-Range header.
+func contentRange(header string) (int64, int64, error) {
+	var start, end, total int64
 
-	err := client.downloadFile(trackID, partialPath)
+	_, err := fmt.Sscanf(header, "bytes %d-%d/%d", &start, &end, &total)
 	if err != nil {
-		return errors.Wrap(err, "failed to download track")
+		return 0, 0, errors.Wrap(err, "invalid content-range")
+	}
+
+	return start, total, nil
+}
+
+// downloadFileAndSetMetadata returns the tracker entry for the track, its
+// path can differ from path when the delivered format has another extension.
+func (client *Client) downloadFileAndSetMetadata(
+	ctx context.Context, trackID, path string, url *trackGetFileUrl.Response, metadata common.Metadata, overwrite bool,
+) (TrackerEntry, error) {
+	url, partialPath, err := client.downloadFile(ctx, trackID, path+".part", url, overwrite)
+	if err != nil {
+		if errors.Is(err, common.ErrAlreadyExists) {
+			return newTrackerEntry(strings.TrimSuffix(partialPath, ".part"), url), err
+		}
+
+		return TrackerEntry{}, errors.Wrap(err, "failed to download track") //nolint:exhaustruct
 	}
 
 	err = SetTags(partialPath, metadata)
 	if err != nil {
-		return errors.Wrap(err, "failed to set tags")
+		return TrackerEntry{}, errors.Wrap(err, "failed to set tags") //nolint:exhaustruct
 	}
 
-	return nil
+	return newTrackerEntry(strings.TrimSuffix(partialPath, ".part"), url), nil
 }
 
 //nolint:cyclop // TODO: refactor
-func (client *Client) downloadTrack(trackID string) error {
+func (client *Client) downloadTrack(ctx context.Context, trackID string) error {
 	if !client.force {
 		_, err := client.trackTracker.Get(trackID)
 		if err == nil {
@@ -92,7 +390,7 @@ func (client *Client) downloadTrack(trackID string) error {
 		}
 	}
 
-	track, err := client.TrackGet(trackID)
+	track, err := client.TrackGet(ctx, trackID)
 	if err != nil {
 		return errors.Wrap(err, "failed to get track")
 	}
@@ -120,14 +418,23 @@ func (client *Client) downloadTrack(trackID string) error {
 		}
 	}
 
-	err = client.downloadFileAndSetMetadata(trackID, trackPath, track.Metadata())
+	metadata := track.Metadata()
+	metadata.Cover = client.albumCover(ctx, track.Album)
+
+	entry, err := client.downloadFileAndSetMetadata(ctx, trackID, trackPath, nil, metadata, client.force)
 	if err != nil {
+		if errors.Is(err, common.ErrAlreadyExists) {
+			if err := client.trackTracker.SetEntry(trackID, entry); err != nil {
+				return errors.Wrap(err, "failed to set track as downloaded")
+			}
+		}
+
 		return errors.Wrap(err, "failed to download and set metadata")
 	}
 
-	log.Info().Msgf("downloaded track: %v", trackPath)
+	log.Info().Msgf("downloaded track: %v", entry.Path)
 
-	err = client.trackTracker.Set(trackID, trackPath)
+	err = client.trackTracker.SetEntry(trackID, entry)
 	if err != nil {
 		return errors.Wrap(err, "failed to set track as downloaded")
 	}
@@ -135,8 +442,8 @@ func (client *Client) downloadTrack(trackID string) error {
 	return nil
 }
 
-func (client *Client) DownloadTrack(trackID string) error {
-	err := client.downloadTrack(trackID)
+func (client *Client) DownloadTrack(ctx context.Context, trackID string) error {
+	err := client.downloadTrack(ctx, trackID)
 	if err != nil {
 		if errors.Is(err, common.ErrAlreadyExists) {
 			dir, _ := client.trackTracker.Get(trackID)
@@ -1,108 +1,208 @@
 package client
 
 import (
+	"context"
 	"crypto/md5" //nolint:gosec // MD5 is used for request signatures
 	"encoding/hex"
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/trevorstarick/qobuz-sync/common"
 	"github.com/trevorstarick/qobuz-sync/responses"
 	albumGet "github.com/trevorstarick/qobuz-sync/responses/album/get"
+	artistGet "github.com/trevorstarick/qobuz-sync/responses/artist/get"
 	catalogSearch "github.com/trevorstarick/qobuz-sync/responses/catalog/search"
 	favoriteGetUserFavorites "github.com/trevorstarick/qobuz-sync/responses/favorite/getUserFavorites"
+	labelGet "github.com/trevorstarick/qobuz-sync/responses/label/get"
 	playlistGet "github.com/trevorstarick/qobuz-sync/responses/playlist/get"
+	playlistGetUserPlaylists "github.com/trevorstarick/qobuz-sync/responses/playlist/getUserPlaylists"
+	purchaseGetUserPurchases "github.com/trevorstarick/qobuz-sync/responses/purchase/getUserPurchases"
 	trackGet "github.com/trevorstarick/qobuz-sync/responses/track/get"
 	trackGetFileUrl "github.com/trevorstarick/qobuz-sync/responses/track/getFileUrl"
 	trackSearch "github.com/trevorstarick/qobuz-sync/responses/track/search"
 )
 
-func (client *Client) TrackSearch(query string) (*trackSearch.TrackSearch, error) {
-	return (Querier[trackSearch.TrackSearch]{client}).Req("track/search", &url.Values{
-		"query": []string{query},
+// TrackSearch pages through the tracks matching query.
+func (client *Client) TrackSearch(ctx context.Context, query string) *Paginator[trackSearch.TrackSearch] {
+	return NewPaginator(ctx, Querier[trackSearch.TrackSearch]{client}, "track/search", func() url.Values {
+		return url.Values{"query": []string{query}}
+	}, func(res *trackSearch.TrackSearch) PageInfo {
+		return PageInfo{Count: len(res.Tracks.Items), Total: res.Tracks.Total}
 	})
 }
 
-func (client *Client) TrackGetFileURL(trackID string, format TrackFormat) (*trackGetFileUrl.Response, error) {
+func (client *Client) TrackGetFileURL(ctx context.Context, trackID string, format TrackFormat, intent FileIntent) (*trackGetFileUrl.Response, error) { //nolint:lll
 	timestamp := strconv.Itoa(int(time.Now().Unix()))
-	sig := "trackgetFileUrlformat_id%vintentstreamtrack_id%v%v%v"
-	sig = fmt.Sprintf(sig, format, trackID, timestamp, client.Secrets[0])
+	sig := "trackgetFileUrlformat_id%vintent%vtrack_id%v%v%v"
+	sig = fmt.Sprintf(sig, format, intent, trackID, timestamp, client.Secrets[0])
 	hash := md5.Sum([]byte(sig)) //nolint:gosec // MD5 is used for request signatures, not security
 	hashedSig := hex.EncodeToString(hash[:])
 
-	res, err := (Querier[trackGetFileUrl.Response]{client}).Req("track/getFileUrl", &url.Values{
+	res, err := (Querier[trackGetFileUrl.Response]{client}).Req(ctx, pathFileURL, &url.Values{
 		"request_ts":  []string{timestamp},
 		"request_sig": []string{hashedSig},
 		"track_id":    []string{trackID},
 		"format_id":   []string{strconv.Itoa(int(format))},
-		"intent":      []string{"stream"},
+		"intent":      []string{string(intent)},
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	if res.FormatID == 0 {
-		return nil, common.ErrUnavailable
+	if res.FormatID == 0 || res.Sample {
+		return nil, restrictionError(res)
 	}
 
 	return res, nil
 }
 
-func (client *Client) TrackGet(trackID string) (*trackGet.Response, error) {
-	return (Querier[trackGet.Response]{client}).Req("track/get", &url.Values{
+// restrictionError explains why no file url was given, from the restriction
+// codes of the response.
+func restrictionError(res *trackGetFileUrl.Response) error {
+	codes := make([]string, 0, len(res.Restrictions))
+	for _, restriction := range res.Restrictions {
+		codes = append(codes, restriction.Code)
+	}
+
+	reason := strings.ToLower(strings.Join(codes, ","))
+
+	switch {
+	case strings.Contains(reason, "country"), strings.Contains(reason, "region"), strings.Contains(reason, "geo"):
+		return errors.Wrap(common.ErrGeoRestricted, reason)
+	case strings.Contains(reason, "uncredentialed"), strings.Contains(reason, "eligible"),
+		strings.Contains(reason, "subscription"), res.Sample:
+		return errors.Wrap(common.ErrSubscriptionRequired, reason)
+	default:
+		return errors.Wrap(common.ErrUnavailable, reason)
+	}
+}
+
+func (client *Client) TrackGet(ctx context.Context, trackID string) (*trackGet.Response, error) {
+	return (Querier[trackGet.Response]{client}).Req(ctx, "track/get", &url.Values{
 		"track_id": []string{trackID},
 	})
 }
 
-func (client *Client) FavoriteGetUserFavorites(listType ListType, offset int) (*favoriteGetUserFavorites.Response, error) { //nolint:lll // long function name
-	timestamp := strconv.Itoa(int(time.Now().Unix()))
-	sig := "favoritegetUserFavorites" + timestamp
-	hash := md5.Sum([]byte(sig)) //nolint:gosec // MD5 is used for request signatures, not security
-	hashedSig := hex.EncodeToString(hash[:])
-
-	return (Querier[favoriteGetUserFavorites.Response]{client}).Req("favorite/getUserFavorites", &url.Values{
-		"limit":       []string{"100"},
-		"offset":      []string{strconv.Itoa(offset)},
-		"type":        []string{string(listType)}, // albums, tracks, artists, article
-		"request_ts":  []string{timestamp},
-		"request_sig": []string{hashedSig},
+// FavoriteGetUserFavorites pages through the user's favorites of listType,
+// newest first.
+func (client *Client) FavoriteGetUserFavorites(ctx context.Context, listType ListType) *Paginator[favoriteGetUserFavorites.Response] {
+	return NewPaginator(ctx, Querier[favoriteGetUserFavorites.Response]{client}, "favorite/getUserFavorites", func() url.Values {
+		timestamp := strconv.Itoa(int(time.Now().Unix()))
+		sig := "favoritegetUserFavorites" + timestamp
+		hash := md5.Sum([]byte(sig)) //nolint:gosec // MD5 is used for request signatures, not security
+		hashedSig := hex.EncodeToString(hash[:])
+
+		return url.Values{
+			"type":        []string{string(listType)}, // albums, tracks, artists, article
+			"request_ts":  []string{timestamp},
+			"request_sig": []string{hashedSig},
+		}
+	}, func(res *favoriteGetUserFavorites.Response) PageInfo {
+		switch listType {
+		case ListTypeALBUM:
+			return PageInfo{Count: len(res.Albums.Items), Total: res.Albums.Total}
+		case ListTypeTRACK:
+			return PageInfo{Count: len(res.Tracks.Items), Total: res.Tracks.Total}
+		default:
+			return PageInfo{Count: len(res.Artists.Items), Total: res.Artists.Total}
+		}
 	})
 }
 
-func (client *Client) AlbumGet(albumID string) (*albumGet.Response, error) {
-	return (Querier[albumGet.Response]{client}).Req("album/get", &url.Values{
+func (client *Client) AlbumGet(ctx context.Context, albumID string) (*albumGet.Response, error) {
+	return (Querier[albumGet.Response]{client}).Req(ctx, "album/get", &url.Values{
 		"album_id": []string{albumID},
 	})
 }
 
-func (client *Client) PlaylistGet(playlistID string) (*playlistGet.Response, error) {
-	var (
-		res *playlistGet.Response
-		err error
+// PurchaseGetUserPurchases pages through the user's purchased albums or
+// tracks.
+func (client *Client) PurchaseGetUserPurchases(ctx context.Context, listType ListType) *Paginator[purchaseGetUserPurchases.Response] {
+	return NewPaginator(ctx, Querier[purchaseGetUserPurchases.Response]{client}, "purchase/getUserPurchases", func() url.Values {
+		return url.Values{"type": []string{string(listType)}} // albums, tracks
+	}, func(res *purchaseGetUserPurchases.Response) PageInfo {
+		if listType == ListTypeALBUM {
+			return PageInfo{Count: len(res.Albums.Items), Total: res.Albums.Total}
+		}
 
-		limit  = 500
-		offset = 0
-		tracks = make([]responses.Track, 0)
-	)
+		return PageInfo{Count: len(res.Tracks.Items), Total: res.Tracks.Total}
+	})
+}
+
+// ArtistGet pages through the artist's releases, every page also holds the
+// artist.
+func (client *Client) ArtistGet(ctx context.Context, artistID string) *Paginator[artistGet.Response] {
+	return NewPaginator(ctx, Querier[artistGet.Response]{client}, "artist/get", func() url.Values {
+		return url.Values{
+			"artist_id": []string{artistID},
+			"extra":     []string{"albums"},
+		}
+	}, func(res *artistGet.Response) PageInfo {
+		return PageInfo{Count: len(res.Albums.Items), Total: res.Albums.Total}
+	})
+}
+
+// LabelGet pages through the label's albums, every page also holds the label.
+func (client *Client) LabelGet(ctx context.Context, labelID string) *Paginator[labelGet.Response] {
+	return NewPaginator(ctx, Querier[labelGet.Response]{client}, "label/get", func() url.Values {
+		return url.Values{
+			"label_id": []string{labelID},
+			"extra":    []string{"albums"},
+		}
+	}, func(res *labelGet.Response) PageInfo {
+		return PageInfo{Count: len(res.Albums.Items), Total: res.Albums.Total}
+	})
+}
+
+// PlaylistGetInfo returns the playlist without its tracks.
+func (client *Client) PlaylistGetInfo(ctx context.Context, playlistID string) (*playlistGet.Response, error) {
+	return (Querier[playlistGet.Response]{client}).Req(ctx, "playlist/get", &url.Values{
+		"playlist_id": []string{playlistID},
+	})
+}
+
+// PlaylistGetUserPlaylists pages through the playlists the user owns or
+// follows.
+func (client *Client) PlaylistGetUserPlaylists(ctx context.Context) *Paginator[playlistGetUserPlaylists.Response] {
+	return NewPaginator(ctx, Querier[playlistGetUserPlaylists.Response]{client}, "playlist/getUserPlaylists", func() url.Values {
+		return url.Values{}
+	}, func(res *playlistGetUserPlaylists.Response) PageInfo {
+		return PageInfo{Count: len(res.Playlists.Items), Total: res.Playlists.Total}
+	})
+}
 
-	for {
-		res, err = (Querier[playlistGet.Response]{client}).Req("playlist/get", &url.Values{
+// PlaylistGetTracks pages through the playlist's tracks, every page also holds
+// the playlist.
+func (client *Client) PlaylistGetTracks(ctx context.Context, playlistID string) *Paginator[playlistGet.Response] {
+	return NewPaginator(ctx, Querier[playlistGet.Response]{client}, "playlist/get", func() url.Values {
+		return url.Values{
 			"playlist_id": []string{playlistID},
 			"extra":       []string{"tracks"},
-			"limit":       []string{strconv.Itoa(limit)},
-			"offset":      []string{strconv.Itoa(offset)},
-		})
-		if err != nil {
-			return nil, err
 		}
+	}, func(res *playlistGet.Response) PageInfo {
+		return PageInfo{Count: len(res.Tracks.Items), Total: res.Tracks.Total}
+	})
+}
 
+// PlaylistGet returns the playlist with all of its tracks.
+func (client *Client) PlaylistGet(ctx context.Context, playlistID string) (*playlistGet.Response, error) {
+	var (
+		res    *playlistGet.Response
+		pages  = client.PlaylistGetTracks(ctx, playlistID).PageSize(MaxPageSize)
+		tracks = make([]responses.Track, 0)
+	)
+
+	for pages.Next() {
+		res = pages.Page()
 		tracks = append(tracks, res.Tracks.Items...)
+	}
 
-		if res.Tracks.Total < res.Tracks.Offset+res.Tracks.Limit {
-			break
-		}
+	if err := pages.Err(); err != nil {
+		return nil, err
 	}
 
 	res.Tracks.Items = tracks
@@ -110,8 +210,15 @@ func (client *Client) PlaylistGet(playlistID string) (*playlistGet.Response, err
 	return res, nil
 }
 
-func (client *Client) CatalogSearch(query string) (*catalogSearch.CatalogSearch, error) {
-	return (Querier[catalogSearch.CatalogSearch]{client}).Req("catalog/search", &url.Values{
-		"query": []string{query},
+// CatalogSearch pages through the albums, artists, playlists and tracks
+// matching query together, until every one of them is exhausted.
+func (client *Client) CatalogSearch(ctx context.Context, query string) *Paginator[catalogSearch.CatalogSearch] {
+	return NewPaginator(ctx, Querier[catalogSearch.CatalogSearch]{client}, "catalog/search", func() url.Values {
+		return url.Values{"query": []string{query}}
+	}, func(res *catalogSearch.CatalogSearch) PageInfo {
+		return PageInfo{
+			Count: max(len(res.Albums.Items), len(res.Artists.Items), len(res.Playlists.Items), len(res.Tracks.Items)),
+			Total: max(res.Albums.Total, res.Artists.Total, res.Playlists.Total, res.Tracks.Total),
+		}
 	})
 }
@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mewkiz/flac"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/helpers"
+	"github.com/trevorstarick/qobuz-sync/responses"
+	trackGetFileUrl "github.com/trevorstarick/qobuz-sync/responses/track/getFileUrl"
+)
+
+const (
+	// maxSampleRate is where the max tier starts, in kHz as Qobuz reports
+	// it. Below it 24-bit is hires, whatever the sampling rate, and 16-bit
+	// is flac.
+	maxSampleRate = 96
+
+	// upgradeSuffix marks the replacement of a track while it downloads,
+	// the original stays in place until the replacement is complete
+	upgradeSuffix = ".upgrade"
+)
+
+var errUnknownFormat = errors.New("format unknown")
+
+// probeFormat works out the format of a track that was downloaded without
+// recording it: FLAC STREAMINFO gives the bit depth and sampling rate, MP3s
+// are lossy.
+func probeFormat(entry TrackerEntry) (TrackerEntry, error) {
+	switch strings.ToLower(filepath.Ext(entry.Path)) {
+	case ".mp3":
+		entry.FormatID = int(QualityMP3)
+		entry.MimeType = helpers.MimeMP3
+
+		return entry, nil
+	case ".flac":
+	default:
+		return entry, errors.Wrapf(errUnknownFormat, "unknown extension %v", filepath.Ext(entry.Path))
+	}
+
+	stream, err := flac.Open(entry.Path)
+	if err != nil {
+		return entry, errors.Wrapf(errUnknownFormat, "unable to read STREAMINFO: %v", err)
+	}
+
+	defer stream.Close()
+
+	entry.BitDepth = int(stream.Info.BitsPerSample)
+	entry.SamplingRate = float64(stream.Info.SampleRate) / 1000 //nolint:gomnd // Hz to kHz
+	entry.MimeType = helpers.MimeFLAC
+
+	entry.FormatID = int(losslessFormat(entry.BitDepth, entry.SamplingRate))
+
+	return entry, nil
+}
+
+// losslessFormat returns the tier a lossless stream falls in, the way the
+// TrackFormat constants define them.
+func losslessFormat(bitDepth int, samplingRate float64) TrackFormat {
+	switch {
+	case bitDepth <= 16: //nolint:gomnd // CD bit depth
+		return QualityFLAC
+	case samplingRate < maxSampleRate:
+		return QualityHIRES
+	default:
+		return QualityMAX
+	}
+}
+
+// beats reports whether a stream of bitDepth and samplingRate beats the
+// format recorded in entry: a higher tier always does, within a tier the
+// higher bit depth or sampling rate does.
+func beats(lossy bool, bitDepth int, samplingRate float64, entry TrackerEntry) bool {
+	if TrackFormat(entry.FormatID).Lossy() || lossy {
+		return TrackFormat(entry.FormatID).Lossy() && !lossy
+	}
+
+	offered := losslessFormat(bitDepth, samplingRate)
+	recorded := losslessFormat(entry.BitDepth, entry.SamplingRate)
+
+	if offered != recorded {
+		return offered > recorded
+	}
+
+	return bitDepth > entry.BitDepth || samplingRate > entry.SamplingRate
+}
+
+// betterThan reports whether the format described by url beats the one
+// recorded in entry.
+func betterThan(url *trackGetFileUrl.Response, entry TrackerEntry) bool {
+	return beats(TrackFormat(url.FormatID).Lossy(), url.BitDepth, url.SamplingRate, entry)
+}
+
+// albumOffersBetter compares the recorded format with what the album
+// currently advertises, so most tracks can be skipped without asking for a
+// file url.
+func albumOffersBetter(album *responses.Album, entry TrackerEntry) bool {
+	if album.MaximumBitDepth == 0 {
+		return false
+	}
+
+	return beats(false, album.MaximumBitDepth, album.MaximumSamplingRate, entry)
+}
+
+// upgradeTrack replaces the track on disk if a better format is available
+// and reports whether it did (or would, when dryRun is set).
+//
+//nolint:cyclop // TODO: refactor
+func (client *Client) upgradeTrack(ctx context.Context, trackID string, dryRun bool) (bool, error) {
+	entry, err := client.trackTracker.GetEntry(trackID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get tracker entry")
+	}
+
+	if !entry.HasFormat() {
+		// downloads from before formats were recorded, the file tells
+		entry, err = probeFormat(entry)
+		if err != nil {
+			return false, err
+		}
+
+		if err := client.trackTracker.SetEntry(trackID, entry); err != nil {
+			return false, errors.Wrap(err, "failed to record track format")
+		}
+	}
+
+	track, err := client.TrackGet(ctx, trackID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get track")
+	}
+
+	if track.Album == nil || !albumOffersBetter(track.Album, entry) {
+		return false, nil
+	}
+
+	url, err := client.trackFileURL(ctx, trackID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get track file url")
+	}
+
+	if !betterThan(url, entry) {
+		return false, nil
+	}
+
+	log.Info().Msgf("upgrade %v-bit/%v kHz -> %v-bit/%v kHz: %v",
+		entry.BitDepth, entry.SamplingRate, url.BitDepth, url.SamplingRate, entry.Path)
+
+	if dryRun {
+		return true, nil
+	}
+
+	path := filepath.Join(client.baseDir, track.Path())
+
+	metadata := track.Metadata()
+	metadata.Cover = client.albumCover(ctx, track.Album)
+
+	// the replacement is downloaded and tagged next to the original and only
+	// renamed over it once complete, a failure leaves the original intact
+	ext := filepath.Ext(path)
+	staging := strings.TrimSuffix(path, ext) + upgradeSuffix + ext
+
+	// the url the comparison was made on is the one downloaded, the file
+	// urls are the budget Qobuz throttles first
+	upgraded, err := client.downloadFileAndSetMetadata(ctx, trackID, staging, url, metadata, true)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to download and set metadata")
+	}
+
+	ext = filepath.Ext(upgraded.Path)
+	final := strings.TrimSuffix(upgraded.Path, upgradeSuffix+ext) + ext
+
+	if err := os.Rename(upgraded.Path, final); err != nil {
+		_ = os.Remove(upgraded.Path)
+
+		return false, errors.Wrap(err, "failed to replace track")
+	}
+
+	upgraded.Path = final
+
+	if upgraded.Path != entry.Path {
+		if err := os.Remove(entry.Path); err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Msgf("unable to remove replaced track: %v", entry.Path)
+		}
+	}
+
+	err = client.trackTracker.SetEntry(trackID, upgraded)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to set track as downloaded")
+	}
+
+	return true, nil
+}
+
+// Upgrade walks every tracked track and downloads a replacement for the ones
+// that are now available in a better format.
+func (client *Client) Upgrade(ctx context.Context, dryRun bool) error {
+	var (
+		wg       sync.WaitGroup
+		upgraded atomic.Int32
+		unknown  atomic.Int32
+		failed   atomic.Int32
+	)
+
+	for _, trackID := range client.trackTracker.Keys() {
+		client.tracks.Go(ctx, &wg, func() {
+			ok, err := client.upgradeTrack(ctx, trackID, dryRun)
+
+			switch {
+			case errors.Is(err, errUnknownFormat):
+				unknown.Add(1)
+			case err != nil:
+				failed.Add(1)
+				log.Warn().Err(err).Msgf("unable to upgrade track, skipping: %v", trackID)
+			case ok:
+				upgraded.Add(1)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "upgrade cancelled")
+	}
+
+	verb := "upgraded"
+	if dryRun {
+		verb = "can upgrade"
+	}
+
+	log.Info().Msgf("%v %d tracks (%d failed, %d of unknown format)",
+		verb, upgraded.Load(), failed.Load(), unknown.Load())
+
+	return nil
+}
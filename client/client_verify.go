@@ -0,0 +1,256 @@
+package client
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+type VerifyIssueKind string
+
+const (
+	VerifyMissing      VerifyIssueKind = "missing"       // tracked but not on disk
+	VerifyCorrupt      VerifyIssueKind = "corrupt"       // bad signature or stream
+	VerifyModified     VerifyIssueKind = "modified"      // checksum differs from the tracker
+	VerifyTags         VerifyIssueKind = "tags"          // tags differ from Track.Metadata()
+	VerifyOrphanedPart VerifyIssueKind = "orphaned_part" // stale .part nothing resumes
+	VerifyUntracked    VerifyIssueKind = "untracked"     // audio file the tracker doesn't know
+)
+
+type VerifyIssue struct {
+	Kind     VerifyIssueKind `json:"kind"`
+	Type     string          `json:"type,omitempty"` // album or track
+	ID       string          `json:"id,omitempty"`
+	Path     string          `json:"path"`
+	Detail   string          `json:"detail,omitempty"`
+	Repaired bool            `json:"repaired,omitempty"`
+}
+
+type VerifyReport struct {
+	Albums int           `json:"albums"`
+	Tracks int           `json:"tracks"`
+	Issues []VerifyIssue `json:"issues"`
+}
+
+type VerifyOptions struct {
+	// Tags compares the title, album, artists, track number, ISRC, label
+	// and Qobuz ids of every track with Track.Metadata(), which costs one
+	// track/get request per track.
+	Tags bool
+	// Repair re-downloads missing, corrupt and mistagged tracks and albums
+	// and removes orphaned .part files.
+	Repair bool
+}
+
+// Verify checks every tracker entry and every file in the base directory.
+//
+//nolint:cyclop,funlen // TODO: refactor
+func (client *Client) Verify(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+
+		report = &VerifyReport{Issues: make([]VerifyIssue, 0)} //nolint:exhaustruct
+		known  = make(map[string]bool)
+	)
+
+	addIssue := func(issue VerifyIssue) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	for _, albumID := range client.albumTracker.Keys() {
+		entry, err := client.albumTracker.lookup(albumID)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Albums++
+
+		if _, err := os.Stat(entry.Path); err != nil {
+			addIssue(VerifyIssue{Kind: VerifyMissing, Type: "album", ID: albumID, Path: entry.Path}) //nolint:exhaustruct
+		}
+	}
+
+	for _, trackID := range client.trackTracker.Keys() {
+		entry, err := client.trackTracker.lookup(trackID)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Tracks++
+		known[entry.Path] = true
+
+		client.tracks.Go(ctx, &wg, func() {
+			issue := client.verifyTrack(ctx, trackID, entry, opts.Tags)
+			if issue != nil {
+				addIssue(*issue)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Wrap(err, "verify cancelled")
+	}
+
+	err := filepath.WalkDir(client.baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path == filepath.Join(client.baseDir, archiveDir) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		switch ext := strings.ToLower(filepath.Ext(path)); {
+		case ext == ".part":
+			if client.orphanedPart(path, d) {
+				addIssue(VerifyIssue{Kind: VerifyOrphanedPart, Path: path}) //nolint:exhaustruct
+			}
+		case (ext == ".flac" || ext == ".mp3") && !known[path]:
+			addIssue(VerifyIssue{Kind: VerifyUntracked, Path: path}) //nolint:exhaustruct
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to walk base dir")
+	}
+
+	sort.Slice(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Path < report.Issues[j].Path
+	})
+
+	if opts.Repair {
+		for i := range report.Issues {
+			report.Issues[i].Repaired = client.repair(ctx, &report.Issues[i])
+		}
+	}
+
+	return report, nil
+}
+
+// orphanedPart reports whether a .part file is left over for good. Downloads
+// that can still be resumed are recorded in the parts bucket, and the
+// temporary files of a write in progress are young.
+func (client *Client) orphanedPart(path string, d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil || time.Since(info.ModTime()) < partMaxAge {
+		return false
+	}
+
+	found, err := client.store.get(bucketParts, path, &partInfo{}) //nolint:exhaustruct
+	if err != nil || found {
+		return false
+	}
+
+	return true
+}
+
+func (client *Client) verifyTrack(ctx context.Context, trackID string, entry TrackerEntry, tags bool) *VerifyIssue {
+	issue := &VerifyIssue{Type: "track", ID: trackID, Path: entry.Path} //nolint:exhaustruct
+
+	info, err := os.Stat(entry.Path)
+	if err != nil {
+		issue.Kind = VerifyMissing
+
+		return issue
+	}
+
+	if err := checkAudio(entry.Path); err != nil {
+		issue.Kind, issue.Detail = VerifyCorrupt, err.Error()
+
+		return issue
+	}
+
+	if tags {
+		track, err := client.TrackGet(ctx, trackID)
+		if err != nil {
+			log.Warn().Err(err).Msgf("unable to get track, not checking tags: %v", entry.Path)
+		} else {
+			mismatched, err := compareTags(entry.Path, track.Metadata())
+			if err != nil {
+				issue.Kind, issue.Detail = VerifyCorrupt, err.Error()
+
+				return issue
+			}
+
+			if len(mismatched) > 0 {
+				issue.Kind, issue.Detail = VerifyTags, strings.Join(mismatched, ",")
+
+				return issue
+			}
+		}
+	}
+
+	if entry.Checksum != "" {
+		if entry.Size != 0 && info.Size() != entry.Size {
+			issue.Kind, issue.Detail = VerifyModified, "size changed"
+
+			return issue
+		}
+
+		sum, err := fileChecksum(entry.Path)
+		if err == nil && sum != entry.Checksum {
+			issue.Kind, issue.Detail = VerifyModified, "checksum changed"
+
+			return issue
+		}
+	}
+
+	return nil
+}
+
+// repair fixes what it can and reports whether it did.
+func (client *Client) repair(ctx context.Context, issue *VerifyIssue) bool {
+	var err error
+
+	switch {
+	case issue.Kind == VerifyOrphanedPart:
+		err = os.Remove(issue.Path)
+	case issue.Type == "album" && issue.Kind == VerifyMissing:
+		err = client.albumTracker.Delete(issue.ID)
+		if err == nil {
+			err = client.DownloadAlbum(ctx, issue.ID)
+		}
+	case issue.Type == "track" && (issue.Kind == VerifyMissing || issue.Kind == VerifyCorrupt || issue.Kind == VerifyTags):
+		if removeErr := os.Remove(issue.Path); removeErr != nil && !os.IsNotExist(removeErr) {
+			err = removeErr
+
+			break
+		}
+
+		err = client.trackTracker.Delete(issue.ID)
+		if err == nil {
+			err = client.downloadTrack(ctx, issue.ID)
+		}
+	default:
+		return false
+	}
+
+	if err != nil {
+		log.Warn().Err(err).Msgf("unable to repair %v: %v", issue.Kind, issue.Path)
+
+		return false
+	}
+
+	log.Info().Msgf("repaired %v: %v", issue.Kind, issue.Path)
+
+	return true
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // register the png decoder for album art
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/helpers"
+	"github.com/trevorstarick/qobuz-sync/responses"
+)
+
+const (
+	// DefaultCoverSize is the default maximum width/height of embedded covers
+	DefaultCoverSize = 1200
+
+	// coverCacheSize is how many album covers are kept in memory, enough
+	// for every album a pool of workers can be on at once
+	coverCacheSize = 64
+
+	coverQuality = 90
+)
+
+type coverEntry struct {
+	mu      sync.Mutex
+	picture *common.Picture
+	// err is a failure that won't go away by asking again, transient ones
+	// aren't kept so the next track tries again
+	err error
+	// warned is set once the failure was logged for the album
+	warned bool
+}
+
+// coverCache fetches each album's cover once and hands the same picture to
+// every track of the album. A fetch that failed transiently is tried again by
+// the next track.
+type coverCache struct {
+	mu      sync.Mutex
+	entries map[string]*coverEntry
+	order   []string
+}
+
+func newCoverCache() *coverCache {
+	return &coverCache{ //nolint:exhaustruct
+		entries: make(map[string]*coverEntry),
+	}
+}
+
+func (cache *coverCache) entry(albumID string) *coverEntry {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if entry, ok := cache.entries[albumID]; ok {
+		return entry
+	}
+
+	if len(cache.order) >= coverCacheSize {
+		delete(cache.entries, cache.order[0])
+		cache.order = cache.order[1:]
+	}
+
+	entry := &coverEntry{} //nolint:exhaustruct
+	cache.entries[albumID] = entry
+	cache.order = append(cache.order, albumID)
+
+	return entry
+}
+
+// albumCover returns the album's front cover scaled down to the client's
+// cover size, or nil when embedding is disabled or the cover is unavailable.
+func (client *Client) albumCover(ctx context.Context, album *responses.Album) *common.Picture {
+	if client.coverSize <= 0 || album == nil {
+		return nil
+	}
+
+	entry := client.covers.entry(album.ID)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.picture != nil || entry.err != nil {
+		return entry.picture
+	}
+
+	picture, err := client.fetchCover(ctx, album)
+	if err != nil {
+		if !retryable(ctx, err) {
+			entry.err = err
+		}
+
+		if !entry.warned {
+			entry.warned = true
+			log.Warn().Err(err).Msgf("unable to fetch cover, not embedding: %v", album.Path())
+		}
+
+		return nil
+	}
+
+	entry.picture = picture
+
+	return picture
+}
+
+func (client *Client) fetchCover(ctx context.Context, album *responses.Album) (*common.Picture, error) {
+	url := album.OriginalImageURL()
+
+	// do some basic verification that the url is valid
+	if !strings.HasPrefix(url, "https://static.qobuz.com/images/covers/") {
+		return nil, errors.New("invalid album art url")
+	}
+
+	img, buf, mime, err := client.fetchImage(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	if bounds.Dx() <= client.coverSize && bounds.Dy() <= client.coverSize {
+		return &common.Picture{MIME: mime, Width: bounds.Dx(), Height: bounds.Dy(), Data: buf}, nil
+	}
+
+	img = downscale(img, client.coverSize)
+
+	out := new(bytes.Buffer)
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: coverQuality}); err != nil {
+		return nil, errors.Wrap(err, "failed to encode album art")
+	}
+
+	bounds = img.Bounds()
+
+	return &common.Picture{MIME: helpers.MimeJPEG, Width: bounds.Dx(), Height: bounds.Dy(), Data: out.Bytes()}, nil
+}
+
+// fetchImage downloads and decodes a JPEG or PNG image, the raw bytes and
+// their type are returned along with it.
+func (client *Client) fetchImage(ctx context.Context, url string) (image.Image, []byte, string, error) {
+	res, err := client.fetch(ctx, url)
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "failed to get image")
+	}
+
+	defer res.Body.Close()
+
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "failed to read image")
+	}
+
+	mime := helpers.SniffContentType(buf)
+	if mime != helpers.MimeJPEG && mime != helpers.MimePNG {
+		return nil, nil, "", &common.ContentError{
+			Expected: []string{helpers.MimeJPEG, helpers.MimePNG},
+			Got:      mime,
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, nil, "", errors.Wrap(err, "failed to decode image")
+	}
+
+	return img, buf, mime, nil
+}
+
+// downscale shrinks img so that neither side exceeds maxSize.
+func downscale(img image.Image, maxSize int) image.Image {
+	src := img.Bounds()
+
+	width, height := maxSize, src.Dy()*maxSize/src.Dx()
+	if src.Dy() > src.Dx() {
+		width, height = src.Dx()*maxSize/src.Dy(), maxSize
+	}
+
+	return resize(img, max(width, 1), max(height, 1))
+}
+
+// resize scales img to width x height, averaging every source pixel that
+// falls into a destination pixel. Upscaling repeats source pixels.
+func resize(img image.Image, width, height int) *image.RGBA {
+	src := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		y0 := src.Min.Y + y*src.Dy()/height
+		y1 := max(src.Min.Y+(y+1)*src.Dy()/height, y0+1)
+
+		for x := range width {
+			x0 := src.Min.X + x*src.Dx()/width
+			x1 := max(src.Min.X+(x+1)*src.Dx()/width, x0+1)
+
+			var r, g, b, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a, n = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/helpers"
+	"github.com/trevorstarick/qobuz-sync/responses"
+)
+
+// goodieTypes maps the extensions of goodie urls to the content expected
+// behind them, goodies with another extension must be of a known type.
+//
+//nolint:gochecknoglobals
+var goodieTypes = map[string]string{
+	".pdf":  helpers.MimePDF,
+	".jpg":  helpers.MimeJPEG,
+	".jpeg": helpers.MimeJPEG,
+	".png":  helpers.MimePNG,
+	".zip":  helpers.MimeZIP,
+	".mp4":  helpers.MimeMP4,
+}
+
+// goodieExtensions is used when the url has no extension.
+//
+//nolint:gochecknoglobals
+var goodieExtensions = map[string]string{
+	helpers.MimePDF:  ".pdf",
+	helpers.MimeJPEG: ".jpg",
+	helpers.MimePNG:  ".png",
+	helpers.MimeZIP:  ".zip",
+	helpers.MimeMP4:  ".mp4",
+}
+
+// albumGoodiesKey is the goodie tracker key recording that every goodie of
+// the album is on disk.
+func albumGoodiesKey(albumID string) string {
+	return "album/" + albumID
+}
+
+// downloadGoodies saves the album's goodies (booklets and such) next to its
+// tracks, goodies already tracked are skipped. The album is recorded in the
+// goodie tracker once all of them are on disk.
+func (client *Client) downloadGoodies(ctx context.Context, album *responses.Album, dir string) error {
+	names := goodieNames(album.Goodies)
+	failed := 0
+
+	for i := range album.Goodies {
+		goodie := &album.Goodies[i]
+
+		err := client.downloadGoodie(ctx, goodie, filepath.Join(dir, names[i]))
+		if err != nil {
+			if errors.Is(err, common.ErrAlreadyExists) {
+				log.Info().Msgf("goodie already exists, skipping: %v", names[i])
+			} else {
+				failed++
+				log.Warn().Err(err).Msgf("unable to download goodie, skipping: %v", names[i])
+			}
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d goodies failed: %v", failed, len(album.Goodies), album.Path())
+	}
+
+	err := client.goodieTracker.Set(albumGoodiesKey(album.ID), dir)
+
+	return errors.Wrap(err, "failed to set goodies as downloaded")
+}
+
+// backfillGoodies downloads the goodies of an album that is already on disk
+// but whose goodies aren't, because they failed or because the album was
+// downloaded before goodies were.
+func (client *Client) backfillGoodies(ctx context.Context, albumID, dir string) error {
+	if _, err := client.goodieTracker.Get(albumGoodiesKey(albumID)); err == nil {
+		return nil
+	}
+
+	album, err := client.AlbumGet(ctx, albumID)
+	if err != nil {
+		return errors.Wrap(err, "album get")
+	}
+
+	return client.downloadGoodies(ctx, album.Album, dir)
+}
+
+// goodieNames returns a file name without extension for every goodie.
+// Albums often ship several goodies with the same name, those are numbered.
+func goodieNames(goodies []responses.Goodie) []string {
+	names := make([]string, len(goodies))
+	seen := make(map[string]int)
+
+	for i, goodie := range goodies {
+		name := helpers.SanitizeStringToPath(goodie.Name)
+		name = strings.Trim(name, ".")
+
+		if name == "" {
+			name = "Goodie"
+		}
+
+		seen[strings.ToLower(name)]++
+		if n := seen[strings.ToLower(name)]; n > 1 {
+			name += " (" + strconv.Itoa(n) + ")"
+		}
+
+		names[i] = name
+	}
+
+	return names
+}
+
+func goodieURL(goodie *responses.Goodie) string {
+	if goodie.OriginalURL != "" {
+		return goodie.OriginalURL
+	}
+
+	return goodie.URL
+}
+
+// downloadGoodie saves the goodie as name plus the extension of its content.
+// The content is checked against the extension of the url.
+func (client *Client) downloadGoodie(ctx context.Context, goodie *responses.Goodie, name string) error {
+	key := strconv.Itoa(goodie.ID)
+
+	if !client.force {
+		if _, err := client.goodieTracker.Get(key); err == nil {
+			return common.ErrAlreadyExists
+		}
+	}
+
+	url := goodieURL(goodie)
+	if url == "" {
+		return errors.New("goodie has no url")
+	}
+
+	res, err := client.fetch(ctx, url)
+	if err != nil {
+		return errors.Wrap(err, "failed to get goodie")
+	}
+
+	defer res.Body.Close()
+
+	mime, body, err := helpers.Sniff(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read goodie")
+	}
+
+	ext := strings.ToLower(path.Ext(url))
+
+	if expected, ok := goodieTypes[ext]; ok {
+		if mime != expected {
+			return &common.ContentError{Expected: []string{expected}, Got: mime}
+		}
+	} else {
+		if _, ok := goodieExtensions[mime]; !ok {
+			expected := make([]string, 0, len(goodieExtensions))
+			for mime := range goodieExtensions {
+				expected = append(expected, mime)
+			}
+
+			sort.Strings(expected)
+
+			return &common.ContentError{Expected: expected, Got: mime}
+		}
+
+		ext = goodieExtensions[mime]
+	}
+
+	file := name + ext
+	part := file + ".part"
+
+	err = writeGoodie(part, body)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(part, file); err != nil {
+		return errors.Wrap(err, "failed to rename goodie")
+	}
+
+	err = client.goodieTracker.SetEntry(key, TrackerEntry{ //nolint:exhaustruct
+		Path:     file,
+		MimeType: mime,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to set goodie as downloaded")
+	}
+
+	log.Info().Msgf("downloaded goodie: %v", file)
+
+	return nil
+}
+
+func writeGoodie(path string, body io.Reader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "failed to create goodie file")
+	}
+
+	_, err = io.Copy(out, body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(path)
+
+		return errors.Wrap(err, "failed to write goodie")
+	}
+
+	return nil
+}
@@ -1,114 +1,363 @@
 package client
 
 import (
+	"context"
 	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/responses"
 	catalogsearch "github.com/trevorstarick/qobuz-sync/responses/catalog/search"
+	favoriteGetUserFavorites "github.com/trevorstarick/qobuz-sync/responses/favorite/getUserFavorites"
 )
 
-func (*Client) GetArtist(_ string) error {
-	return common.ErrNotImplemented
+// Search returns the first page of results for query.
+func (client *Client) Search(ctx context.Context, query string) (*catalogsearch.CatalogSearch, error) {
+	pages := client.CatalogSearch(ctx, query)
+	if !pages.Next() {
+		return nil, pages.Err()
+	}
+
+	return pages.Page(), nil
 }
 
-func (client *Client) Search(query string) (*catalogsearch.CatalogSearch, error) {
-	return client.CatalogSearch(query)
+// FavoriteAlbums downloads the albums favorited since the last sync, nothing
+// is fetched when the favorites didn't change since.
+func (client *Client) FavoriteAlbums(ctx context.Context, mirror MirrorOptions) error {
+	list := favoriteList{
+		kind:       "album",
+		listType:   ListTypeALBUM,
+		syncKey:    syncFavoriteAlbums,
+		lastUpdate: client.lastUpdate.FavoriteAlbum,
+		pool:       newPool(client.jobs),
+		items: func(res *favoriteGetUserFavorites.Response) []favoriteItem {
+			items := make([]favoriteItem, 0, len(res.Albums.Items))
+
+			for i := range res.Albums.Items {
+				album := &res.Albums.Items[i]
+				items = append(items, favoriteItem{
+					id:          album.ID,
+					favoritedAt: album.FavoritedAt,
+					download: func() bool {
+						return client.downloadAlbumAndArt(ctx, album)
+					},
+				})
+			}
+
+			return items
+		},
+	}
+
+	return client.syncFavorites(ctx, list, mirror)
 }
 
-func (client *Client) FavoriteAlbums() error {
-	offset := 0
+// favoriteItem is an album or track of a favorites page.
+type favoriteItem struct {
+	id          string
+	favoritedAt int
+	// download reports whether the item is now on disk
+	download func() bool
+}
 
-	for {
-		res, err := client.FavoriteGetUserFavorites(ListTypeALBUM, offset)
-		if err != nil {
-			return errors.Wrap(err, "unable to get favorites list")
-		}
+// favoriteList is what tells the favorite albums and tracks apart.
+type favoriteList struct {
+	kind       string // album or track
+	listType   ListType
+	syncKey    string
+	lastUpdate int
+	pool       *pool
+	items      func(res *favoriteGetUserFavorites.Response) []favoriteItem
+}
+
+// syncFavorites downloads the items of list favorited since the last sync,
+// nothing is fetched when the favorites didn't change since.
+//
+//nolint:cyclop // TODO: refactor
+func (client *Client) syncFavorites(ctx context.Context, list favoriteList, mirror MirrorOptions) error {
+	state, err := client.loadSyncState(list.syncKey)
+	if err != nil {
+		return err
+	}
 
-		for i := range res.Albums.Items {
-			album := &res.Albums.Items[i]
+	if state.unchanged(list.lastUpdate) && !mirror.Enabled {
+		log.Info().Msgf("favorite %vs unchanged since the last sync", list.kind)
 
-			_, err = client.downloadAlbum(album.ID)
-			if err != nil {
-				if errors.Is(err, common.ErrAlreadyExists) {
-					dir, _ := client.albumTracker.Get(album.ID)
-					log.Info().Msgf("album already exists: %v", dir)
-				} else {
-					log.Warn().Msgf("unable to download album, skipping: %v", err)
-				}
+		return nil
+	}
+
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Int32
+		newest = state.FavoritedAt
+		remote = make(map[string]bool)
+		pages  = client.FavoriteGetUserFavorites(ctx, list.listType)
+	)
+
+	for pages.Next() {
+		fresh := 0
+
+		for _, item := range list.items(pages.Page()) {
+			remote[item.id] = true
 
+			if !state.isNew(item.favoritedAt) {
 				continue
 			}
 
-			albumDir := filepath.Join(client.baseDir, album.Path())
+			fresh++
+			newest = max(newest, item.favoritedAt)
+			client.recordFavorite(list.kind, item.id, item.favoritedAt)
 
-			err = album.DownloadAlbumArt(albumDir)
-			if err != nil {
-				if errors.Is(err, common.ErrAlreadyExists) {
-					log.Info().Msgf("album art already exists: %v/album.jpg", albumDir)
-				} else {
-					log.Warn().Msgf("unable to download album art, skipping: %v", err)
+			list.pool.Go(ctx, &wg, func() {
+				if !item.download() {
+					failed.Add(1)
 				}
+			})
+		}
 
-				continue
-			}
+		// favorites are listed newest first, a page without anything new
+		// means the rest was processed by the last sync. Mirroring needs
+		// the whole list.
+		if fresh == 0 && state.FavoritedAt != 0 && !mirror.Enabled {
+			pages.Stop()
 		}
+	}
+
+	wg.Wait()
 
-		if res.Albums.Offset+res.Albums.Limit >= res.Albums.Total {
-			break
+	// items dropped by the pool never ran, saving the sync state would skip
+	// them for good
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "favorites sync cancelled")
+	}
+
+	if err := pages.Err(); err != nil {
+		return errors.Wrap(err, "unable to get favorites list")
+	}
+
+	if n := failed.Load(); n > 0 {
+		log.Warn().Msgf("%d favorite %vs failed, they will be retried next time", n, list.kind)
+	} else {
+		err = client.saveSyncState(list.syncKey, syncState{ //nolint:exhaustruct
+			LastUpdate:  list.lastUpdate,
+			FavoritedAt: newest,
+		})
+		if err != nil {
+			return err
 		}
+	}
 
-		offset += res.Albums.Limit
+	if mirror.Enabled {
+		return client.mirrorFavorites(list.kind, remote, mirror)
 	}
 
 	return nil
 }
 
-func (client *Client) FavoriteTracks() error {
-	offset := 0
+// downloadAlbumAndArt reports whether the album is now on disk.
+func (client *Client) downloadAlbumAndArt(ctx context.Context, album *responses.Album) bool {
+	_, err := client.downloadAlbum(ctx, album.ID)
+	if err != nil {
+		if errors.Is(err, common.ErrAlreadyExists) {
+			dir, _ := client.albumTracker.Get(album.ID)
+			log.Info().Msgf("album already exists: %v", dir)
 
-	for {
-		res, err := client.FavoriteGetUserFavorites(ListTypeTRACK, offset)
-		if err != nil {
-			return errors.Wrap(err, "unable to get favorites list")
+			return true
 		}
 
-		for _, track := range res.Tracks.Items {
-			err = client.downloadTrack(strconv.Itoa(track.ID))
-			if err != nil {
-				if errors.Is(err, common.ErrAlreadyExists) {
-					path, _ := client.trackTracker.Get(strconv.Itoa(track.ID))
-					log.Info().Msgf("track already exists: %v", path)
-				} else {
-					log.Warn().Msgf("unable to download track, skipping: %v", err)
-				}
+		log.Warn().Msgf("unable to download album, skipping: %v", err)
 
-				continue
+		return false
+	}
+
+	albumDir := filepath.Join(client.baseDir, album.Path())
+
+	err = client.downloadAlbumArt(ctx, album, albumDir)
+	if err != nil {
+		if errors.Is(err, common.ErrAlreadyExists) {
+			log.Info().Msgf("album art already exists: %v", albumDir)
+		} else {
+			log.Warn().Msgf("unable to download album art, skipping: %v", err)
+		}
+	}
+
+	return true
+}
+
+// FavoriteTracks downloads the tracks favorited since the last sync, nothing
+// is fetched when the favorites didn't change since.
+func (client *Client) FavoriteTracks(ctx context.Context, mirror MirrorOptions) error {
+	list := favoriteList{
+		kind:       "track",
+		listType:   ListTypeTRACK,
+		syncKey:    syncFavoriteTracks,
+		lastUpdate: client.lastUpdate.FavoriteTrack,
+		pool:       client.tracks,
+		items: func(res *favoriteGetUserFavorites.Response) []favoriteItem {
+			items := make([]favoriteItem, 0, len(res.Tracks.Items))
+
+			for i := range res.Tracks.Items {
+				track := &res.Tracks.Items[i]
+				items = append(items, favoriteItem{
+					id:          strconv.Itoa(track.ID),
+					favoritedAt: track.FavoritedAt,
+					download: func() bool {
+						return client.downloadTrackAndArt(ctx, track)
+					},
+				})
 			}
 
-			albumDir := filepath.Join(client.baseDir, track.Album.Path())
+			return items
+		},
+	}
 
-			err = track.Album.DownloadAlbumArt(albumDir)
-			if err != nil {
-				if errors.Is(err, common.ErrAlreadyExists) {
-					log.Info().Msgf("album art already exists: %v/album.jpg", albumDir)
-				} else {
-					log.Warn().Msgf("unable to download album art, skipping: %v", err)
-				}
+	return client.syncFavorites(ctx, list, mirror)
+}
 
-				continue
+// downloadTrackAndArt reports whether the track is now on disk.
+func (client *Client) downloadTrackAndArt(ctx context.Context, track *responses.Track) bool {
+	err := client.downloadTrack(ctx, strconv.Itoa(track.ID))
+	if err != nil {
+		if errors.Is(err, common.ErrAlreadyExists) {
+			path, _ := client.trackTracker.Get(strconv.Itoa(track.ID))
+			log.Info().Msgf("track already exists: %v", path)
+
+			return true
+		}
+
+		log.Warn().Msgf("unable to download track, skipping: %v", err)
+
+		return false
+	}
+
+	if track.Album == nil {
+		return true
+	}
+
+	albumDir := filepath.Join(client.baseDir, track.Album.Path())
+
+	err = client.downloadAlbumArt(ctx, track.Album, albumDir)
+	if err != nil {
+		if errors.Is(err, common.ErrAlreadyExists) {
+			log.Info().Msgf("album art already exists: %v", albumDir)
+		} else {
+			log.Warn().Msgf("unable to download album art, skipping: %v", err)
+		}
+	}
+
+	return true
+}
+
+// artistWatermark is the newest release of a followed artist that was seen.
+type artistWatermark struct {
+	Name string `json:"name"`
+	// AddedAt is the newest release, see albumAddedAt
+	AddedAt   int       `json:"added_at"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// FavoriteArtists follows every favorite artist and downloads the releases
+// that appeared since the last run. The first run of an artist only records
+// their newest release unless the client resyncs.
+func (client *Client) FavoriteArtists(ctx context.Context) error {
+	pages := client.FavoriteGetUserFavorites(ctx, ListTypeARTIST)
+
+	for pages.Next() {
+		res := pages.Page()
+
+		for i := range res.Artists.Items {
+			artist := &res.Artists.Items[i]
+
+			err := client.followArtist(ctx, strconv.Itoa(artist.ID))
+			if ctx.Err() != nil {
+				return errors.Wrap(ctx.Err(), "favorite artists cancelled")
+			}
+
+			if err != nil {
+				log.Warn().Err(err).Msgf("unable to check artist, skipping: %v", artist.Name)
 			}
 		}
+	}
+
+	return errors.Wrap(pages.Err(), "unable to get favorites list")
+}
+
+//nolint:cyclop // TODO: refactor
+func (client *Client) followArtist(ctx context.Context, artistID string) error {
+	var watermark artistWatermark
+
+	found, err := client.store.get(bucketArtists, artistID, &watermark)
+	if err != nil {
+		return errors.Wrap(err, "unable to get artist watermark")
+	}
+
+	// resyncing downloads the whole discography again
+	backfill := client.resync
+	found = found && !backfill
+
+	artist, releases, err := client.artistReleases(ctx, artistID)
+	if err != nil {
+		return err
+	}
+
+	releases = dedupeReleases(releases)
+
+	var (
+		wg     sync.WaitGroup
+		albums = newPool(client.jobs)
+		failed atomic.Int32
+		newest = watermark.AddedAt
+	)
+
+	for i := range releases {
+		album := &releases[i]
+		addedAt := albumAddedAt(album)
+		newest = max(newest, addedAt)
+
+		if found && addedAt <= watermark.AddedAt {
+			continue
+		}
 
-		if res.Tracks.Offset+res.Tracks.Limit >= res.Tracks.Total {
-			break
+		if !found && !backfill {
+			continue
 		}
 
-		offset += res.Tracks.Limit
+		log.Info().Msgf("new release: %v - %v (%v)", artist.Name, album.Title, album.ReleaseDateOriginal)
+
+		albums.Go(ctx, &wg, func() {
+			if !client.downloadAlbumAndArt(ctx, album) {
+				failed.Add(1)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "artist check cancelled")
+	}
+
+	if !found && !backfill {
+		log.Info().Msgf("following %v, %d releases", artist.Name, len(releases))
+	}
+
+	if n := failed.Load(); n > 0 {
+		return errors.Errorf("%d releases of %v failed, not updating the watermark", n, artist.Name)
+	}
+
+	err = client.store.put(bucketArtists, artistID, artistWatermark{
+		Name:      artist.Name,
+		AddedAt:   newest,
+		CheckedAt: time.Now(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to save artist watermark")
 	}
 
 	return nil
@@ -118,7 +367,8 @@ func (client *Client) FavoriteTracks() error {
 // https://open.qobuz.com/album/0603497932191
 // https://open.qobuz.com/artist/34527
 // https://open.qobuz.com/playlist/2418316
-func (client *Client) Link(link string) error {
+// https://open.qobuz.com/label/1024
+func (client *Client) Link(ctx context.Context, link string) error {
 	u, err := url.Parse(link) //nolint:varnamelen
 	if err != nil {
 		return errors.Wrap(err, "unable to parse link")
@@ -136,13 +386,15 @@ func (client *Client) Link(link string) error {
 
 		switch parts[0] {
 		case "track":
-			return client.DownloadTrack(parts[1])
+			return client.DownloadTrack(ctx, parts[1])
 		case "album":
-			return client.DownloadAlbum(parts[1])
+			return client.DownloadAlbum(ctx, parts[1])
 		case "artist":
-			return common.ErrNotImplemented
+			return client.DownloadArtist(ctx, parts[1])
 		case "playlist":
-			return client.DownloadPlaylist(parts[1])
+			return client.DownloadPlaylist(ctx, parts[1], MirrorOptions{}) //nolint:exhaustruct
+		case "label":
+			return client.DownloadLabel(ctx, parts[1], LabelFilter{}) //nolint:exhaustruct
 		default:
 			return errors.Wrap(common.ErrNotImplemented, "unsupported link")
 		}
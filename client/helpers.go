@@ -1,14 +1,21 @@
 package client
 
 import (
+	"bytes"
+	"encoding/binary"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/frolovo22/tag"
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/trevorstarick/qobuz-sync/common"
 )
 
+// pictureTypeFrontCover is the picture type shared by FLAC and ID3v2
+const pictureTypeFrontCover = 3
+
 func SetTags(path string, tags common.Metadata) error {
 	fileTags, err := tag.ReadFile(path)
 	if err != nil {
@@ -20,7 +27,6 @@ func SetTags(path string, tags common.Metadata) error {
 		fileTags.SetAlbumArtist(tags.AlbumArtist),
 		fileTags.SetArtist(tags.Artist),
 
-		fileTags.SetComment(tags.Comment),
 		fileTags.SetGenre(tags.Genre),
 		fileTags.SetDate(tags.Date),
 		fileTags.SetComposer(tags.Composer),
@@ -34,7 +40,34 @@ func SetTags(path string, tags common.Metadata) error {
 		}
 	}
 
-	err = fileTags.SaveFile(strings.TrimSuffix(path, ".part"))
+	if tags.Comment != "" {
+		if err := fileTags.SetComment(tags.Comment); err != nil {
+			return errors.Wrap(err, "failed to set tag")
+		}
+	}
+
+	if tags.Cover != nil {
+		if err := embedCover(fileTags, tags.Cover); err != nil {
+			log.Warn().Err(err).Msgf("unable to embed cover: %v", path)
+		}
+	}
+
+	out := strings.TrimSuffix(path, ".part")
+	fields := tagFields(tags)
+
+	switch fileTags := fileTags.(type) {
+	case *tag.FLAC:
+		err = saveFLAC(fileTags, fields, out)
+	case *tag.ID3v24:
+		setID3Fields(fileTags.SetString, fileTags.SetStringTXXX, fields, id3v24Separator)
+		err = replaceFile(out, fileTags.Save)
+	case *tag.ID3v23:
+		setID3Fields(fileTags.SetString, fileTags.SetStringTXXX, fields, id3v23Separator)
+		err = replaceFile(out, fileTags.Save)
+	default:
+		err = replaceFile(out, fileTags.Save)
+	}
+
 	if err != nil {
 		return errors.Wrap(err, "failed to save tags")
 	}
@@ -46,3 +79,73 @@ func SetTags(path string, tags common.Metadata) error {
 
 	return nil
 }
+
+// embedCover stores picture as the front cover. The tag library can read
+// pictures but not write them, so the blocks/frames are built here.
+func embedCover(fileTags tag.Metadata, picture *common.Picture) error {
+	switch fileTags := fileTags.(type) {
+	case *tag.FLAC:
+		fileTags.Blocks = slices.DeleteFunc(fileTags.Blocks, func(block *tag.FlacMetadataBlock) bool {
+			return block.Type == tag.FlacPicture
+		})
+
+		data := flacPictureBlock(picture)
+		fileTags.Blocks = append(fileTags.Blocks, &tag.FlacMetadataBlock{
+			IsLast: false,
+			Type:   tag.FlacPicture,
+			Size:   len(data),
+			Data:   data,
+		})
+	case *tag.ID3v24:
+		fileTags.Frames = slices.DeleteFunc(fileTags.Frames, func(frame tag.ID3v24Frame) bool {
+			return frame.Key == "APIC"
+		})
+		fileTags.Frames = append(fileTags.Frames, tag.ID3v24Frame{Key: "APIC", Value: id3PictureFrame(picture)})
+	case *tag.ID3v23:
+		fileTags.Frames = slices.DeleteFunc(fileTags.Frames, func(frame tag.ID3v23Frame) bool {
+			return frame.Key == "APIC"
+		})
+		fileTags.Frames = append(fileTags.Frames, tag.ID3v23Frame{Key: "APIC", Value: id3PictureFrame(picture)})
+	default:
+		return errors.Errorf("unsupported tag version %v", fileTags.GetVersion())
+	}
+
+	return nil
+}
+
+// flacPictureBlock encodes a METADATA_BLOCK_PICTURE, every integer is a
+// big endian uint32.
+func flacPictureBlock(picture *common.Picture) []byte {
+	buf := new(bytes.Buffer)
+
+	writeUint32 := func(v int) {
+		_ = binary.Write(buf, binary.BigEndian, uint32(v)) //nolint:gosec
+	}
+
+	writeUint32(pictureTypeFrontCover)
+	writeUint32(len(picture.MIME))
+	buf.WriteString(picture.MIME)
+	writeUint32(0) // description
+	writeUint32(picture.Width)
+	writeUint32(picture.Height)
+	writeUint32(24) //nolint:gomnd // colour depth
+	writeUint32(0)  // indexed colours, 0 for non indexed images
+	writeUint32(len(picture.Data))
+	buf.Write(picture.Data)
+
+	return buf.Bytes()
+}
+
+// id3PictureFrame encodes an APIC frame body with an empty description.
+func id3PictureFrame(picture *common.Picture) []byte {
+	buf := new(bytes.Buffer)
+
+	buf.WriteByte(0) // ISO-8859-1 text encoding
+	buf.WriteString(picture.MIME)
+	buf.WriteByte(0)
+	buf.WriteByte(pictureTypeFrontCover)
+	buf.WriteByte(0) // description
+	buf.Write(picture.Data)
+
+	return buf.Bytes()
+}
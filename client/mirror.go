@@ -0,0 +1,343 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMirrorLimit is how many items a mirror run may remove at most
+	DefaultMirrorLimit = 25
+
+	// archiveDir is where mirror mode moves dropped items unless pruning
+	archiveDir = "_archive"
+)
+
+var errMirrorLimit = errors.New("too many items to remove")
+
+// MirrorOptions makes a sync remove what is no longer part of the remote
+// list. Only items that came from that list are considered.
+type MirrorOptions struct {
+	Enabled bool
+	// Prune deletes dropped items instead of moving them to _archive.
+	Prune bool
+	// DryRun only reports what would be removed.
+	DryRun bool
+	// Limit aborts the removal when more items would go, 0 disables it.
+	Limit int
+}
+
+// mirrorItem is a tracked album or track that was dropped remotely.
+type mirrorItem struct {
+	kind string // album or track
+	id   string
+	path string
+}
+
+// applyMirror reports the dropped items and then archives or deletes them.
+// forget is called for every item that is gone so the caller can drop its
+// own records.
+func (client *Client) applyMirror(
+	opts MirrorOptions, usage *trackUsage, dropped []mirrorItem, forget func(mirrorItem),
+) error {
+	if len(dropped) == 0 {
+		log.Info().Msg("mirror: nothing to remove")
+
+		return nil
+	}
+
+	verb := "archive"
+	if opts.Prune {
+		verb = "delete"
+	}
+
+	for _, item := range dropped {
+		log.Info().Msgf("mirror: %v %v %v: %v", verb, item.kind, item.id, item.path)
+	}
+
+	if opts.DryRun {
+		log.Info().Msgf("mirror: dry run, would %v %d items", verb, len(dropped))
+
+		return nil
+	}
+
+	if opts.Limit > 0 && len(dropped) > opts.Limit {
+		return errors.Wrapf(errMirrorLimit, "%d items would be removed but the limit is %d", len(dropped), opts.Limit)
+	}
+
+	for _, item := range dropped {
+		if err := client.removeItem(usage, item, opts.Prune); err != nil {
+			log.Warn().Err(err).Msgf("mirror: unable to %v %v: %v", verb, item.kind, item.path)
+
+			continue
+		}
+
+		forget(item)
+	}
+
+	return nil
+}
+
+// removeItem moves the item to the archive (or deletes it) and drops it from
+// the trackers. Tracks and goodies of a removed album go with it, unless one
+// of its tracks is still in use: then only the files that aren't go and the
+// album directory stays.
+func (client *Client) removeItem(usage *trackUsage, item mirrorItem, prune bool) error {
+	if item.kind == "track" {
+		if item.path != "" {
+			if err := client.archive(item.path, prune); err != nil {
+				return err
+			}
+		}
+
+		delete(usage.tracks, item.id)
+
+		return client.trackTracker.Delete(item.id)
+	}
+
+	kept := make(map[string]bool)
+
+	for trackID, entry := range usage.tracks {
+		if item.path != "" && isWithin(entry.Path, item.path) &&
+			usage.inUse(trackID, entry.Path, item.id, false, "") {
+			kept[trackID] = true
+		}
+	}
+
+	if len(kept) == 0 && item.path != "" {
+		if err := client.archive(item.path, prune); err != nil {
+			return err
+		}
+	}
+
+	if len(kept) > 0 {
+		log.Info().Msgf("mirror: keeping %d tracks still in use: %v", len(kept), item.path)
+	}
+
+	for _, tracker := range []*Tracker{client.trackTracker, client.goodieTracker} {
+		entries, err := tracker.entries()
+		if err != nil {
+			return err
+		}
+
+		for key, entry := range entries {
+			if !isWithin(entry.Path, item.path) || (tracker == client.trackTracker && kept[key]) {
+				continue
+			}
+
+			if len(kept) > 0 {
+				if err := client.archive(entry.Path, prune); err != nil {
+					return err
+				}
+			}
+
+			if err := tracker.Delete(key); err != nil {
+				return err
+			}
+
+			if tracker == client.trackTracker {
+				delete(usage.tracks, key)
+			}
+		}
+	}
+
+	if err := client.goodieTracker.Delete(albumGoodiesKey(item.id)); err != nil {
+		return err
+	}
+
+	delete(usage.albums, item.path)
+
+	return client.albumTracker.Delete(item.id)
+}
+
+// archive moves path into the archive, or deletes it when pruning. Nothing
+// outside of the base dir is touched.
+func (client *Client) archive(path string, prune bool) error {
+	if !isWithin(path, client.baseDir) {
+		return errors.Errorf("%v is outside of the base dir", path)
+	}
+
+	if prune {
+		return errors.Wrap(os.RemoveAll(path), "unable to delete")
+	}
+
+	rel, err := filepath.Rel(client.baseDir, path)
+	if err != nil {
+		return errors.Wrap(err, "unable to locate in the base dir")
+	}
+
+	dst := filepath.Join(client.baseDir, archiveDir, rel)
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return errors.Wrap(err, "unable to create archive dir")
+	}
+
+	if err := os.Rename(path, dst); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to move to archive")
+	}
+
+	return nil
+}
+
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// trackUsage is a snapshot of what keeps tracks in use, loaded once per
+// mirror run rather than once per track.
+type trackUsage struct {
+	tracks map[string]TrackerEntry
+	// albums maps the directory of every downloaded album to its id
+	albums    map[string]string
+	favorites map[string]bool
+	// playlists maps every synced playlist to the tracks it holds
+	playlists map[string]playlistState
+}
+
+func (client *Client) loadTrackUsage() (*trackUsage, error) {
+	usage := &trackUsage{
+		tracks:    nil,
+		albums:    make(map[string]string),
+		favorites: make(map[string]bool),
+		playlists: make(map[string]playlistState),
+	}
+
+	tracks, err := client.trackTracker.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	usage.tracks = tracks
+
+	albums, err := client.albumTracker.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	for albumID, entry := range albums {
+		usage.albums[filepath.Clean(entry.Path)] = albumID
+	}
+
+	favorites, err := client.store.keys(bucketFavorites, "track/")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list favorites")
+	}
+
+	for _, key := range favorites {
+		usage.favorites[strings.TrimPrefix(key, "track/")] = true
+	}
+
+	playlists, err := client.store.keys(bucketPlaylistTracks, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list playlists")
+	}
+
+	for _, playlistID := range playlists {
+		state, _, err := client.loadPlaylistState(playlistID)
+		if err != nil {
+			return nil, err
+		}
+
+		usage.playlists[playlistID] = state
+	}
+
+	return usage, nil
+}
+
+// inUse reports whether a track is still wanted by something else than the
+// list dropping it: a downloaded album, a favorite or a playlist.
+func (usage *trackUsage) inUse(trackID, path, ignoreAlbum string, ignoreFavorite bool, ignorePlaylist string) bool {
+	// the album holding the track is one of the directories above it
+	for dir := filepath.Dir(filepath.Clean(path)); ; dir = filepath.Dir(dir) {
+		if albumID, ok := usage.albums[dir]; ok && albumID != ignoreAlbum {
+			return true
+		}
+
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	if !ignoreFavorite && usage.favorites[trackID] {
+		return true
+	}
+
+	for playlistID, state := range usage.playlists {
+		if playlistID != ignorePlaylist && state.contains(trackID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// droppedTrack returns the mirror item for a track no longer in a list, or
+// nil when it isn't downloaded or still in use. The list itself is ignored.
+func droppedTrack(usage *trackUsage, trackID string, ignoreFavorite bool, ignorePlaylist string) *mirrorItem {
+	entry, ok := usage.tracks[trackID]
+	if !ok {
+		return nil
+	}
+
+	if usage.inUse(trackID, entry.Path, "", ignoreFavorite, ignorePlaylist) {
+		log.Debug().Msgf("mirror: keeping track still in use: %v", entry.Path)
+
+		return nil
+	}
+
+	return &mirrorItem{kind: "track", id: trackID, path: entry.Path}
+}
+
+// mirrorFavorites removes the albums or tracks (kind) that were downloaded as
+// favorites but are no longer part of remote.
+func (client *Client) mirrorFavorites(kind string, remote map[string]bool, opts MirrorOptions) error {
+	keys, err := client.store.keys(bucketFavorites, kind+"/")
+	if err != nil {
+		return errors.Wrap(err, "unable to list favorites")
+	}
+
+	forget := func(item mirrorItem) {
+		if err := client.store.delete(bucketFavorites, kind+"/"+item.id); err != nil {
+			log.Warn().Err(err).Msgf("mirror: unable to forget favorite %v/%v", kind, item.id)
+		}
+	}
+
+	usage, err := client.loadTrackUsage()
+	if err != nil {
+		return err
+	}
+
+	dropped := make([]mirrorItem, 0)
+
+	for _, key := range keys {
+		id := strings.TrimPrefix(key, kind+"/")
+		if remote[id] {
+			continue
+		}
+
+		var item *mirrorItem
+
+		if kind == "album" {
+			if entry, err := client.albumTracker.lookup(id); err == nil {
+				item = &mirrorItem{kind: kind, id: id, path: entry.Path}
+			}
+		} else {
+			item = droppedTrack(usage, id, true, "")
+		}
+
+		switch {
+		case item != nil:
+			dropped = append(dropped, *item)
+		case !opts.DryRun:
+			forget(mirrorItem{kind: kind, id: id, path: ""})
+		}
+	}
+
+	return client.applyMirror(opts, usage, dropped, forget)
+}
@@ -0,0 +1,56 @@
+package client
+
+import "time"
+
+const (
+	DefaultJobs = 4
+
+	// DefaultRequestTimeout is how long a request may wait on the server
+	DefaultRequestTimeout = 30 * time.Second
+)
+
+type Options struct {
+	BaseDir string
+	Force   bool
+
+	// Resync ignores what previous runs saved about the favorites, labels,
+	// artists and playlists and goes through them again in full. Unlike
+	// Force, what is already on disk isn't downloaded again. Force implies
+	// it.
+	Resync bool
+
+	// Jobs is the maximum number of tracks (and albums) processed at once.
+	Jobs int
+
+	// Quality is the ranked list of formats to request, nil means DefaultQuality.
+	Quality Quality
+	// StrictQuality skips tracks that are not available in the first format
+	// of Quality instead of saving them at a lower quality.
+	StrictQuality bool
+
+	// CoverSize is the maximum width/height of the cover art embedded in
+	// every track, larger covers are scaled down. 0 disables embedding.
+	CoverSize int
+
+	// Releases picks what is downloaded from an artist's discography.
+	Releases ReleaseFilter
+
+	// PlaylistOutputs are the files written for every playlist, nil means
+	// DefaultPlaylistOutputs.
+	PlaylistOutputs []PlaylistOutput
+
+	// RequestTimeout aborts a request when the server keeps it waiting
+	// for the response or for more data that long, 0 disables it.
+	RequestTimeout time.Duration
+
+	// Retries is how many times a failed request is retried, RetryBudget
+	// how many retries the whole run may spend. 0 disables retrying.
+	Retries     int
+	RetryBudget int
+
+	// RateLimit is how many API requests are sent per second at most,
+	// FileURLRateLimit the same for file urls, which have their own budget.
+	// Both slow down while the server answers with 429. 0 disables them.
+	RateLimit        float64
+	FileURLRateLimit float64
+}
@@ -0,0 +1,134 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPageSize is how many items a paginator asks for per request
+	DefaultPageSize = 100
+
+	// MaxPageSize is the largest limit the API honours
+	MaxPageSize = 500
+)
+
+// PageInfo describes the list a response holds a page of.
+type PageInfo struct {
+	// Count is the number of items in the page
+	Count int
+	// Total is the number of items in the whole list
+	Total int
+}
+
+// PageSource fetches one page of a list, Querier is the one talking to the
+// API.
+type PageSource[T any] interface {
+	Req(ctx context.Context, path string, query *url.Values) (*T, error)
+}
+
+// Paginator walks a list endpoint one page at a time:
+//
+//	pages := client.LabelGet(ctx, labelID)
+//	for pages.Next() {
+//		res := pages.Page()
+//		...
+//	}
+//	if err := pages.Err(); err != nil {
+//		...
+//	}
+//
+// Stop, or the end of the context, ends the walk early and the next call to
+// Next returns false.
+type Paginator[T any] struct {
+	ctx     context.Context //nolint:containedctx // the walk spans several calls
+	querier PageSource[T]
+	path    string
+	query   func() url.Values
+	info    func(*T) PageInfo
+
+	size   int
+	offset int
+	done   bool
+	page   *T
+	err    error
+}
+
+// NewPaginator pages through path until ctx is done. query builds the
+// parameters of each request, without limit and offset, and info tells where
+// a response is in the list.
+func NewPaginator[T any](
+	ctx context.Context, querier PageSource[T], path string, query func() url.Values, info func(*T) PageInfo,
+) *Paginator[T] {
+	return &Paginator[T]{ //nolint:exhaustruct
+		ctx:     ctx,
+		querier: querier,
+		path:    path,
+		query:   query,
+		info:    info,
+		size:    DefaultPageSize,
+	}
+}
+
+// PageSize sets how many items are asked for per request, clamped to
+// 1..MaxPageSize.
+func (p *Paginator[T]) PageSize(size int) *Paginator[T] {
+	p.size = min(max(size, 1), MaxPageSize)
+
+	return p
+}
+
+// Next fetches the next page and reports whether there was one. The first
+// page is always fetched, even when the list is empty, so the rest of the
+// response can be read.
+func (p *Paginator[T]) Next() bool {
+	if p.done {
+		return false
+	}
+
+	if err := p.ctx.Err(); err != nil {
+		p.err, p.done = errors.Wrap(err, "pagination cancelled"), true
+
+		return false
+	}
+
+	query := p.query()
+	query.Set("limit", strconv.Itoa(p.size))
+	query.Set("offset", strconv.Itoa(p.offset))
+
+	page, err := p.querier.Req(p.ctx, p.path, &query)
+	if err != nil {
+		p.err, p.done = err, true
+
+		return false
+	}
+
+	info := p.info(page)
+
+	// the offset follows what was returned rather than what was asked
+	// for, the API may cap the limit. An empty page ends the walk even if
+	// the total promises more.
+	p.page = page
+	p.offset += info.Count
+	p.done = info.Count == 0 || p.offset >= info.Total
+
+	return true
+}
+
+// Page returns the response fetched by the last call to Next.
+func (p *Paginator[T]) Page() *T {
+	return p.page
+}
+
+// Err returns the error that ended the walk, if any.
+func (p *Paginator[T]) Err() error {
+	return p.err
+}
+
+// Stop ends the walk, pages that weren't fetched yet never are.
+func (p *Paginator[T]) Stop() {
+	p.done = true
+}
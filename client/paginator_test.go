@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+type fakePage struct {
+	Items []int
+	Total int
+}
+
+// fakeSource serves a list of total items, limits above maxLimit are capped
+// and the page at emptyAt comes back empty.
+type fakeSource struct {
+	total    int
+	maxLimit int
+	emptyAt  int
+	requests int
+}
+
+func (source *fakeSource) Req(ctx context.Context, _ string, query *url.Values) (*fakePage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	source.requests++
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+
+	if source.maxLimit > 0 {
+		limit = min(limit, source.maxLimit)
+	}
+
+	page := &fakePage{Items: nil, Total: source.total}
+	if source.emptyAt > 0 && offset >= source.emptyAt {
+		return page, nil
+	}
+
+	for i := offset; i < min(offset+limit, source.total); i++ {
+		page.Items = append(page.Items, i)
+	}
+
+	return page, nil
+}
+
+func TestPaginator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		source   fakeSource
+		size     int
+		stopAt   int
+		cancel   bool
+		items    int
+		requests int
+		err      bool
+	}{
+		{name: "empty", source: fakeSource{total: 0}, size: 10, items: 0, requests: 1},
+		{name: "one full page", source: fakeSource{total: 10}, size: 10, items: 10, requests: 1},
+		{name: "page size plus one", source: fakeSource{total: 11}, size: 10, items: 11, requests: 2},
+		{name: "capped limit", source: fakeSource{total: 25, maxLimit: 4}, size: 10, items: 25, requests: 7},
+		{name: "empty page before total", source: fakeSource{total: 30, emptyAt: 20}, size: 10, items: 20, requests: 3},
+		{name: "stop", source: fakeSource{total: 50}, size: 10, stopAt: 2, items: 20, requests: 2},
+		{name: "cancelled", source: fakeSource{total: 50}, size: 10, cancel: true, items: 0, requests: 0, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if test.cancel {
+				cancel()
+			}
+
+			source := test.source
+			pages := NewPaginator[fakePage](ctx, &source, "list", func() url.Values { return url.Values{} }, func(page *fakePage) PageInfo {
+				return PageInfo{Count: len(page.Items), Total: page.Total}
+			}).PageSize(test.size)
+
+			var items []int
+
+			for n := 1; pages.Next(); n++ {
+				items = append(items, pages.Page().Items...)
+
+				if n == test.stopAt {
+					pages.Stop()
+				}
+			}
+
+			if len(items) != test.items {
+				t.Errorf("got %d items, want %d", len(items), test.items)
+			}
+
+			for i, item := range items {
+				if item != i {
+					t.Fatalf("item %d is %d, pages overlap or skip", i, item)
+				}
+			}
+
+			if source.requests != test.requests {
+				t.Errorf("got %d requests, want %d", source.requests, test.requests)
+			}
+
+			if err := pages.Err(); (err != nil) != test.err {
+				t.Errorf("got error %v, want error %v", err, test.err)
+			} else if test.cancel && !errors.Is(err, context.Canceled) {
+				t.Errorf("got error %v, want context.Canceled", err)
+			}
+
+			if pages.Next() {
+				t.Error("Next returned true after the walk ended")
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/common"
+	playlistGet "github.com/trevorstarick/qobuz-sync/responses/playlist/get"
+)
+
+const (
+	playlistCoverFile = "cover.jpg"
+
+	// collageTile is the size of each of the four covers of a collage, the
+	// size of the "large" album images
+	collageTile = 600
+)
+
+// playlistCoverKey identifies the tracks a cover was made from.
+func playlistCoverKey(res *playlistGet.Response) string {
+	hash := sha256.New()
+
+	for _, track := range res.Tracks.Items {
+		hash.Write([]byte(strconv.Itoa(track.ID) + "\n"))
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// collageURLs returns the covers of the first four distinct albums of the
+// playlist, or nil when there are fewer.
+func collageURLs(res *playlistGet.Response) []string {
+	var (
+		urls = make([]string, 0, 4) //nolint:gomnd
+		seen = make(map[string]bool)
+	)
+
+	for _, track := range res.Tracks.Items {
+		album := track.Album
+		if album == nil || seen[album.ID] || album.Image.Large == "" {
+			continue
+		}
+
+		seen[album.ID] = true
+		urls = append(urls, album.Image.Large)
+
+		if len(urls) == cap(urls) {
+			return urls
+		}
+	}
+
+	return nil
+}
+
+// writePlaylistCover saves cover.jpg into dir unless it was already made from
+// the same tracks.
+func (client *Client) writePlaylistCover(ctx context.Context, res *playlistGet.Response, dir string) error {
+	playlistID := strconv.Itoa(res.ID)
+	file := filepath.Join(dir, playlistCoverFile)
+	key := playlistCoverKey(res)
+
+	var previous string
+
+	found, err := client.store.get(bucketPlaylistCovers, playlistID, &previous)
+	if err != nil {
+		return errors.Wrap(err, "unable to get playlist cover key")
+	}
+
+	if _, err := os.Stat(file); err == nil && found && previous == key && !client.force {
+		return common.ErrAlreadyExists
+	}
+
+	img, err := client.playlistCover(ctx, res)
+	if err != nil {
+		return err
+	}
+
+	tmp := file + ".part"
+
+	out, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrap(err, "failed to create cover")
+	}
+
+	err = jpeg.Encode(out, img, &jpeg.Options{Quality: coverQuality})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp)
+
+		return errors.Wrap(err, "failed to write cover")
+	}
+
+	if err := os.Rename(tmp, file); err != nil {
+		return errors.Wrap(err, "failed to rename cover")
+	}
+
+	return errors.Wrap(client.store.put(bucketPlaylistCovers, playlistID, key), "unable to save playlist cover key")
+}
+
+// playlistCover builds a 2x2 collage of album covers, falling back to the
+// playlist's rectangle image.
+func (client *Client) playlistCover(ctx context.Context, res *playlistGet.Response) (image.Image, error) {
+	urls := collageURLs(res)
+	if urls != nil {
+		collage, err := client.buildCollage(ctx, urls)
+		if err == nil {
+			return collage, nil
+		}
+
+		log.Warn().Err(err).Msgf("unable to build collage, using the playlist image: %v", res.Name)
+	}
+
+	for _, url := range res.ImageRectangle {
+		if !strings.HasPrefix(url, "https://static.qobuz.com/images/") {
+			continue
+		}
+
+		img, _, _, err := client.fetchImage(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		return img, nil
+	}
+
+	return nil, errors.Wrap(common.ErrUnavailable, "no playlist image")
+}
+
+func (client *Client) buildCollage(ctx context.Context, urls []string) (image.Image, error) {
+	collage := image.NewRGBA(image.Rect(0, 0, 2*collageTile, 2*collageTile))
+
+	for i, url := range urls {
+		if !strings.HasPrefix(url, "https://static.qobuz.com/images/covers/") {
+			return nil, errors.New("invalid album art url")
+		}
+
+		img, _, _, err := client.fetchImage(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		x, y := (i%2)*collageTile, (i/2)*collageTile //nolint:gomnd
+		tile := resize(img, collageTile, collageTile)
+
+		draw.Draw(collage, image.Rect(x, y, x+collageTile, y+collageTile), tile, image.Point{}, draw.Src)
+	}
+
+	return collage, nil
+}
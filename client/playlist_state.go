@@ -0,0 +1,146 @@
+package client
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/trevorstarick/qobuz-sync/responses"
+)
+
+// playlistState is what the last sync of a playlist saw.
+type playlistState struct {
+	// UpdatedAt is the playlist's updated_at, an unchanged value lets a
+	// sync skip fetching the tracks
+	UpdatedAt int                  `json:"updated_at"`
+	Tracks    []playlistStateTrack `json:"tracks"`
+}
+
+type playlistStateTrack struct {
+	TrackID string `json:"track_id"`
+	// PlaylistTrackID identifies the track's slot in the playlist, so the
+	// same track added twice is told apart
+	PlaylistTrackID int `json:"playlist_track_id"`
+}
+
+func newPlaylistState(updatedAt int, tracks []responses.Track) playlistState {
+	state := playlistState{UpdatedAt: updatedAt, Tracks: make([]playlistStateTrack, 0, len(tracks))}
+
+	for _, track := range tracks {
+		state.Tracks = append(state.Tracks, playlistStateTrack{
+			TrackID:         strconv.Itoa(track.ID),
+			PlaylistTrackID: track.PlaylistTrackID,
+		})
+	}
+
+	return state
+}
+
+// loadPlaylistState returns the state saved by the last sync of the playlist.
+func (client *Client) loadPlaylistState(playlistID string) (playlistState, bool, error) {
+	var state playlistState
+
+	found, err := client.store.get(bucketPlaylistTracks, playlistID, &state)
+	if err != nil {
+		return state, false, errors.Wrap(err, "unable to get playlist state")
+	}
+
+	return state, found, nil
+}
+
+func (client *Client) savePlaylistState(playlistID string, state playlistState) error {
+	return errors.Wrap(client.store.put(bucketPlaylistTracks, playlistID, state), "unable to save playlist state")
+}
+
+// contains reports whether the playlist had the track in any slot.
+func (state playlistState) contains(trackID string) bool {
+	for _, track := range state.Tracks {
+		if track.TrackID == trackID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// playlistDiff is how a playlist changed between two syncs.
+type playlistDiff struct {
+	Added     []playlistStateTrack
+	Removed   []playlistStateTrack
+	Reordered int
+}
+
+// diffPlaylist compares two states slot by slot. Slots are matched by their
+// PlaylistTrackID, or by track id when the API left them out.
+// Reordered counts the kept tracks that had to move, i.e. the ones outside the
+// longest run that kept its relative order.
+func diffPlaylist(previous, current playlistState) playlistDiff {
+	byTrackID := false
+
+	for _, track := range previous.Tracks {
+		if track.PlaylistTrackID == 0 {
+			byTrackID = true
+
+			break
+		}
+	}
+
+	key := func(track playlistStateTrack) string {
+		if byTrackID {
+			return track.TrackID
+		}
+
+		return strconv.Itoa(track.PlaylistTrackID)
+	}
+
+	oldIndex := make(map[string]int, len(previous.Tracks))
+	for i, track := range previous.Tracks {
+		oldIndex[key(track)] = i
+	}
+
+	diff := playlistDiff{Added: nil, Removed: nil, Reordered: 0}
+	seen := make(map[string]bool, len(current.Tracks))
+	kept := make([]int, 0, len(current.Tracks))
+
+	for _, track := range current.Tracks {
+		k := key(track)
+		if seen[k] {
+			continue
+		}
+
+		seen[k] = true
+
+		if i, ok := oldIndex[k]; ok {
+			kept = append(kept, i)
+		} else {
+			diff.Added = append(diff.Added, track)
+		}
+	}
+
+	for _, track := range previous.Tracks {
+		if !seen[key(track)] {
+			diff.Removed = append(diff.Removed, track)
+		}
+	}
+
+	diff.Reordered = len(kept) - longestIncreasing(kept)
+
+	return diff
+}
+
+// longestIncreasing returns the length of the longest strictly increasing
+// subsequence of values.
+func longestIncreasing(values []int) int {
+	tails := make([]int, 0, len(values))
+
+	for _, value := range values {
+		i := sort.SearchInts(tails, value)
+		if i == len(tails) {
+			tails = append(tails, value)
+		} else {
+			tails[i] = value
+		}
+	}
+
+	return len(tails)
+}
@@ -0,0 +1,397 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/responses"
+)
+
+type PlaylistFormat string
+
+const (
+	PlaylistM3U  PlaylistFormat = "m3u"
+	PlaylistM3U8 PlaylistFormat = "m3u8"
+	PlaylistPLS  PlaylistFormat = "pls"
+	PlaylistXSPF PlaylistFormat = "xspf"
+	PlaylistJSPF PlaylistFormat = "jspf"
+)
+
+// PlaylistOutput is a playlist file written for every downloaded playlist.
+type PlaylistOutput struct {
+	Format PlaylistFormat
+	// Absolute writes absolute paths instead of paths relative to the
+	// playlist directory.
+	Absolute bool
+}
+
+//nolint:gochecknoglobals
+var DefaultPlaylistOutputs = []PlaylistOutput{{Format: PlaylistM3U, Absolute: false}}
+
+// playlistWriters holds a writer for every format.
+//
+//nolint:gochecknoglobals
+var playlistWriters = map[PlaylistFormat]playlistWriter{
+	PlaylistM3U:  m3uWriter{},
+	PlaylistM3U8: m3uWriter{},
+	PlaylistPLS:  plsWriter{},
+	PlaylistXSPF: xspfWriter{},
+	PlaylistJSPF: jspfWriter{},
+}
+
+// ParsePlaylistOutputs parses a comma separated list of formats such as
+// "m3u,xspf:absolute", every format can be suffixed with ":relative" (the
+// default) or ":absolute".
+func ParsePlaylistOutputs(list string) ([]PlaylistOutput, error) {
+	outputs := make([]PlaylistOutput, 0)
+
+	for _, spec := range strings.Split(list, ",") {
+		spec = strings.ToLower(strings.TrimSpace(spec))
+		if spec == "" {
+			continue
+		}
+
+		name, style, _ := strings.Cut(spec, ":")
+		output := PlaylistOutput{Format: PlaylistFormat(name), Absolute: false}
+
+		if _, ok := playlistWriters[output.Format]; !ok {
+			return nil, errors.Wrapf(common.ErrInvalidArgs, "unknown playlist format %q", name)
+		}
+
+		switch style {
+		case "", "relative":
+		case "absolute":
+			output.Absolute = true
+		default:
+			return nil, errors.Wrapf(common.ErrInvalidArgs, "unknown path style %q", style)
+		}
+
+		outputs = append(outputs, output)
+	}
+
+	if len(outputs) == 0 {
+		return nil, errors.Wrap(common.ErrInvalidArgs, "empty playlist formats")
+	}
+
+	return outputs, nil
+}
+
+// playlistEntry is a playlist track that is on disk.
+type playlistEntry struct {
+	Track *responses.Track
+	Path  string
+	// Location is Path as written to the playlist file
+	Location string
+}
+
+// Artist is the track's own performer, the album artist is only a fallback.
+func (entry playlistEntry) Artist() string {
+	switch {
+	case entry.Track.Performer != nil && entry.Track.Performer.Name != "":
+		return entry.Track.Performer.Name
+	case entry.Track.Album != nil && entry.Track.Album.Artist != nil:
+		return entry.Track.Album.Artist.Name
+	default:
+		return ""
+	}
+}
+
+func (entry playlistEntry) Album() string {
+	if entry.Track.Album == nil {
+		return ""
+	}
+
+	return entry.Track.Album.Title
+}
+
+// playlistFile is what the writers get to write.
+type playlistFile struct {
+	ID      string
+	Name    string
+	Owner   string
+	Entries []playlistEntry
+}
+
+type playlistWriter interface {
+	Write(w io.Writer, playlist *playlistFile) error
+}
+
+// sortPlaylistEntries orders entries by their position in the playlist, the
+// listing order is kept for tracks without one.
+func sortPlaylistEntries(entries []playlistEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Track.Position < entries[j].Track.Position
+	})
+}
+
+// writePlaylist writes playlist as output into dir and returns the path of
+// the file.
+func writePlaylist(dir string, playlist playlistFile, output PlaylistOutput) (string, error) {
+	path := filepath.Join(dir, "playlist."+string(output.Format))
+
+	entries := make([]playlistEntry, len(playlist.Entries))
+
+	for i, entry := range playlist.Entries {
+		location, err := entryLocation(dir, entry.Path, output)
+		if err != nil {
+			return "", err
+		}
+
+		entry.Location = location
+		entries[i] = entry
+	}
+
+	playlist.Entries = entries
+
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		return playlistWriters[output.Format].Write(w, &playlist)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// entryLocation returns path relative to dir or absolute. XSPF and JSPF
+// expect URIs, so their paths are escaped and absolute ones become file URLs.
+func entryLocation(dir, path string, output PlaylistOutput) (string, error) {
+	var err error
+
+	if output.Absolute {
+		path, err = filepath.Abs(path)
+	} else {
+		path, err = filepath.Rel(dir, path)
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, "failed to resolve track path")
+	}
+
+	if output.Format != PlaylistXSPF && output.Format != PlaylistJSPF {
+		return path, nil
+	}
+
+	uri := url.URL{Path: filepath.ToSlash(path)} //nolint:exhaustruct
+	if output.Absolute {
+		uri.Scheme = "file"
+	}
+
+	return uri.String(), nil
+}
+
+// writeFileAtomic writes to a temporary file first so an interrupted run
+// keeps the previous file.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	return replaceFile(path, func(file io.WriteSeeker) error {
+		w := bufio.NewWriter(file)
+
+		if err := write(w); err != nil {
+			return err
+		}
+
+		return errors.Wrap(w.Flush(), "failed to flush")
+	})
+}
+
+// replaceFile is writeFileAtomic for writers that need to seek, it hands the
+// temporary file itself to write.
+func replaceFile(path string, write func(file io.WriteSeeker) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.part")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temp file")
+	}
+
+	defer os.Remove(tmp.Name()) //nolint:errcheck // gone after the rename
+
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Chmod(common.FilePerm)
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to write file")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), path), "failed to rename file")
+}
+
+// m3uWriter writes an extended m3u, m3u8 is the same in UTF-8 which is what
+// is always written.
+type m3uWriter struct{}
+
+func (m3uWriter) Write(w io.Writer, playlist *playlistFile) error {
+	_, err := fmt.Fprintf(w, "#EXTM3U\n#EXTENC: UTF-8\n#PLAYLIST: %v\n#EXTID: %v\n", playlist.Name, playlist.ID)
+	if err != nil {
+		return errors.Wrap(err, "failed to write m3u")
+	}
+
+	for _, entry := range playlist.Entries {
+		_, err := fmt.Fprintf(w, "#EXTINF:%d,%v - %v\n%v\n",
+			entry.Track.Duration, entry.Artist(), entry.Track.Title, entry.Location)
+		if err != nil {
+			return errors.Wrap(err, "failed to write m3u")
+		}
+	}
+
+	return nil
+}
+
+type plsWriter struct{}
+
+func (plsWriter) Write(w io.Writer, playlist *playlistFile) error {
+	buf := new(strings.Builder)
+
+	buf.WriteString("[playlist]\n")
+
+	for i, entry := range playlist.Entries {
+		n := i + 1
+		fmt.Fprintf(buf, "File%d=%v\n", n, entry.Location)
+		fmt.Fprintf(buf, "Title%d=%v - %v\n", n, entry.Artist(), entry.Track.Title)
+		fmt.Fprintf(buf, "Length%d=%d\n", n, entry.Track.Duration)
+	}
+
+	fmt.Fprintf(buf, "NumberOfEntries=%d\nVersion=2\n", len(playlist.Entries))
+
+	_, err := io.WriteString(w, buf.String())
+
+	return errors.Wrap(err, "failed to write pls")
+}
+
+// isrcIdentifier is how XSPF and JSPF identify a track by its ISRC.
+func isrcIdentifier(isrc string) []string {
+	if isrc == "" {
+		return nil
+	}
+
+	return []string{"urn:isrc:" + isrc}
+}
+
+// https://www.xspf.org/spec
+type xspfPlaylist struct {
+	XMLName    xml.Name    `xml:"playlist"`
+	Version    string      `xml:"version,attr"`
+	Xmlns      string      `xml:"xmlns,attr"`
+	Title      string      `xml:"title,omitempty"`
+	Creator    string      `xml:"creator,omitempty"`
+	Identifier string      `xml:"identifier,omitempty"`
+	Tracks     []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string   `xml:"location"`
+	Identifier []string `xml:"identifier,omitempty"`
+	Title      string   `xml:"title,omitempty"`
+	Creator    string   `xml:"creator,omitempty"`
+	Album      string   `xml:"album,omitempty"`
+	TrackNum   int      `xml:"trackNum,omitempty"`
+	Duration   int      `xml:"duration,omitempty"` // milliseconds
+}
+
+type xspfWriter struct{}
+
+func (xspfWriter) Write(w io.Writer, playlist *playlistFile) error {
+	doc := xspfPlaylist{
+		XMLName:    xml.Name{}, //nolint:exhaustruct
+		Version:    "1",
+		Xmlns:      "http://xspf.org/ns/0/",
+		Title:      playlist.Name,
+		Creator:    playlist.Owner,
+		Identifier: "qobuz:playlist:" + playlist.ID,
+		Tracks:     make([]xspfTrack, 0, len(playlist.Entries)),
+	}
+
+	for _, entry := range playlist.Entries {
+		doc.Tracks = append(doc.Tracks, xspfTrack{
+			Location:   entry.Location,
+			Identifier: isrcIdentifier(entry.Track.Isrc),
+			Title:      entry.Track.Title,
+			Creator:    entry.Artist(),
+			Album:      entry.Album(),
+			TrackNum:   entry.Track.TrackNumber,
+			Duration:   entry.Track.Duration * 1000, //nolint:gomnd
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return errors.Wrap(err, "failed to write xspf")
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(doc); err != nil {
+		return errors.Wrap(err, "failed to write xspf")
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return errors.Wrap(err, "failed to write xspf")
+}
+
+// https://www.xspf.org/jspf
+type jspfPlaylist struct {
+	Playlist struct {
+		Title      string      `json:"title,omitempty"`
+		Creator    string      `json:"creator,omitempty"`
+		Identifier string      `json:"identifier,omitempty"`
+		Track      []jspfTrack `json:"track"`
+	} `json:"playlist"`
+}
+
+type jspfTrack struct {
+	Location   []string `json:"location"`
+	Identifier []string `json:"identifier,omitempty"`
+	Title      string   `json:"title,omitempty"`
+	Creator    string   `json:"creator,omitempty"`
+	Album      string   `json:"album,omitempty"`
+	TrackNum   int      `json:"trackNum,omitempty"`
+	Duration   int      `json:"duration,omitempty"` // milliseconds
+}
+
+type jspfWriter struct{}
+
+func (jspfWriter) Write(w io.Writer, playlist *playlistFile) error {
+	var doc jspfPlaylist
+
+	doc.Playlist.Title = playlist.Name
+	doc.Playlist.Creator = playlist.Owner
+	doc.Playlist.Identifier = "qobuz:playlist:" + playlist.ID
+	doc.Playlist.Track = make([]jspfTrack, 0, len(playlist.Entries))
+
+	for _, entry := range playlist.Entries {
+		doc.Playlist.Track = append(doc.Playlist.Track, jspfTrack{
+			Location:   []string{entry.Location},
+			Identifier: isrcIdentifier(entry.Track.Isrc),
+			Title:      entry.Track.Title,
+			Creator:    entry.Artist(),
+			Album:      entry.Album(),
+			TrackNum:   entry.Track.TrackNumber,
+			Duration:   entry.Track.Duration * 1000, //nolint:gomnd
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	return errors.Wrap(enc.Encode(doc), "failed to write jspf")
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+// pool bounds the number of tasks that run at the same time. Tasks are
+// tracked by the caller's WaitGroup so several callers can share one pool
+// and still wait for only their own work.
+type pool struct {
+	sem chan struct{}
+}
+
+func newPool(size int) *pool {
+	if size < 1 {
+		size = 1
+	}
+
+	return &pool{
+		sem: make(chan struct{}, size),
+	}
+}
+
+// Go blocks until a slot is free and then runs task in a new goroutine. Once
+// ctx is done tasks are dropped instead.
+func (p *pool) Go(ctx context.Context, wg *sync.WaitGroup, task func()) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+
+	if ctx.Err() != nil {
+		<-p.sem
+
+		return
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer func() {
+			<-p.sem
+			wg.Done()
+		}()
+
+		task()
+	}()
+}
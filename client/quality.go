@@ -0,0 +1,170 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/common"
+	trackGetFileUrl "github.com/trevorstarick/qobuz-sync/responses/track/getFileUrl"
+)
+
+//nolint:gochecknoglobals
+var trackFormatNames = map[string]TrackFormat{
+	"mp3":   QualityMP3,
+	"flac":  QualityFLAC,
+	"hires": QualityHIRES,
+	"max":   QualityMAX,
+}
+
+func (format TrackFormat) String() string {
+	for name, f := range trackFormatNames {
+		if f == format {
+			return name
+		}
+	}
+
+	return strconv.Itoa(int(format))
+}
+
+// Lossy reports whether the format is a lossy encoding.
+func (format TrackFormat) Lossy() bool {
+	return format == QualityMP3
+}
+
+// Extension returns the file extension used for the format.
+func (format TrackFormat) Extension() string {
+	if format.Lossy() {
+		return ".mp3"
+	}
+
+	return ".flac"
+}
+
+func ParseTrackFormat(name string) (TrackFormat, error) {
+	format, ok := trackFormatNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return 0, errors.Wrapf(common.ErrInvalidArgs, "unknown quality %q", name)
+	}
+
+	return format, nil
+}
+
+// Quality is a ranked list of formats, the first entry is the preferred one
+// and every following entry is an acceptable fallback.
+type Quality []TrackFormat
+
+//nolint:gochecknoglobals
+var (
+	DefaultQuality  = Quality{QualityMAX, QualityHIRES, QualityFLAC, QualityMP3}
+	LosslessQuality = Quality{QualityMAX, QualityHIRES, QualityFLAC}
+)
+
+// ParseQuality parses a comma separated chain such as "hires,flac,mp3".
+// "lossless" expands to every lossless format and "any" to every format.
+func ParseQuality(chain string) (Quality, error) {
+	quality := Quality{}
+
+	for _, name := range strings.Split(chain, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+			continue
+		case "lossless":
+			quality = append(quality, LosslessQuality...)
+		case "any":
+			quality = append(quality, DefaultQuality...)
+		default:
+			format, err := ParseTrackFormat(name)
+			if err != nil {
+				return nil, err
+			}
+
+			quality = append(quality, format)
+		}
+	}
+
+	if len(quality) == 0 {
+		return nil, errors.Wrap(common.ErrInvalidArgs, "empty quality")
+	}
+
+	return quality, nil
+}
+
+func (quality Quality) Contains(format TrackFormat) bool {
+	for _, f := range quality {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (quality Quality) String() string {
+	names := make([]string, 0, len(quality))
+	for _, format := range quality {
+		names = append(names, format.String())
+	}
+
+	return strings.Join(names, ",")
+}
+
+// trackFileURL walks the client's quality chain until Qobuz hands back a
+// format that is part of the chain.
+func (client *Client) trackFileURL(ctx context.Context, trackID string) (*trackGetFileUrl.Response, error) {
+	intent := IntentStream
+	if _, ok := client.purchased.Load("track/" + trackID); ok {
+		intent = IntentDownload
+	}
+
+	var restricted error
+
+	for _, format := range client.quality {
+		res, err := client.TrackGetFileURL(ctx, trackID, format, intent)
+		if err != nil {
+			// the subscription may still cover a lower quality, a geo
+			// restriction applies to all of them
+			if errors.Is(err, common.ErrSubscriptionRequired) {
+				restricted = err
+
+				continue
+			}
+
+			if errors.Is(err, common.ErrUnavailable) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		delivered := TrackFormat(res.FormatID)
+		if !client.quality.Contains(delivered) {
+			log.Debug().Msgf("track %v requested %v got %v, trying next quality", trackID, format, delivered)
+
+			continue
+		}
+
+		if delivered != client.quality[0] {
+			if client.strictQuality {
+				return nil, errors.Wrapf(common.ErrQualityUnavailable, "wanted %v got %v", client.quality[0], delivered)
+			}
+
+			event := log.Info()
+			if delivered.Lossy() {
+				event = log.Warn()
+			}
+
+			event.Msgf("track %v is only available as %v, wanted %v", trackID, delivered, client.quality[0])
+		}
+
+		return res, nil
+	}
+
+	if restricted != nil {
+		return nil, errors.Wrapf(restricted, "no format in %v", client.quality)
+	}
+
+	return nil, errors.Wrapf(common.ErrQualityUnavailable, "no format in %v", client.quality)
+}
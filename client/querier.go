@@ -3,20 +3,21 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
-	"github.com/trevorstarick/qobuz-sync/common"
 )
 
 type Querier[T any] struct {
 	*Client
 }
 
-func (q Querier[T]) prepareRequest(path string, query *url.Values) (*http.Request, error) {
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, baseAPI+path, http.NoBody)
+func (q Querier[T]) prepareRequest(ctx context.Context, path string, query *url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseAPI+path, http.NoBody)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create request")
 	}
@@ -39,17 +40,40 @@ func (q Querier[T]) prepareRequest(path string, query *url.Values) (*http.Reques
 	return req, nil
 }
 
-func (q Querier[T]) Req(path string, query *url.Values) (*T, error) {
+// Req requests path and decodes the response. Requests are paced by the
+// path's rate limit and transient failures are retried.
+func (q Querier[T]) Req(ctx context.Context, path string, query *url.Values) (*T, error) {
+	limit := q.limiter(path)
+
+	for attempt := 1; ; attempt++ {
+		if err := limit.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		t, err := q.req(ctx, path, query)
+		if err == nil {
+			return t, nil
+		}
+
+		limit.observe(err)
+
+		if err := q.retry.backoff(ctx, attempt, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (q Querier[T]) req(ctx context.Context, path string, query *url.Values) (*T, error) {
 	log.Debug().Str("path", path).Str("query", query.Encode()).Msg("requesting")
 
-	req, err := q.prepareRequest(path, query)
+	req, err := q.prepareRequest(ctx, path, query)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to prepare request")
 	}
 
-	res, err := q.c.Do(req)
+	res, err := q.do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to do request")
+		return nil, err
 	}
 
 	defer func() {
@@ -58,16 +82,8 @@ func (q Querier[T]) Req(path string, query *url.Values) (*T, error) {
 		}
 	}()
 
-	switch res.StatusCode {
-	case http.StatusOK:
-	case http.StatusNotFound:
-		return nil, errors.Wrap(common.ErrNotFound, "not found")
-	case http.StatusBadRequest:
-		return nil, errors.Wrap(common.ErrBadRequest, "bad request")
-	case http.StatusUnauthorized:
-		return nil, errors.Wrap(common.ErrAuthFailed, "invalid token")
-	default:
-		return nil, errors.Errorf("invalid status code: %d", res.StatusCode)
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(res)
 	}
 
 	t := new(T)
@@ -77,3 +93,63 @@ func (q Querier[T]) Req(path string, query *url.Values) (*T, error) {
 
 	return t, nil
 }
+
+// idleBody aborts the request once no data arrived for the request timeout.
+type idleBody struct {
+	io.ReadCloser
+
+	timer   *time.Timer
+	timeout time.Duration
+	cancel  context.CancelFunc
+}
+
+func (body *idleBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	if n > 0 {
+		body.timer.Reset(body.timeout)
+	}
+
+	return n, err //nolint:wrapcheck // io.EOF must be returned as is
+}
+
+func (body *idleBody) Close() error {
+	body.timer.Stop()
+	defer body.cancel()
+
+	return body.ReadCloser.Close() //nolint:wrapcheck
+}
+
+// do sends req, which is aborted when the server keeps it waiting for the
+// response or for more of the body for longer than the request timeout.
+func (client *Client) do(req *http.Request) (*http.Response, error) {
+	if client.requestTimeout <= 0 {
+		res, err := client.c.Do(req)
+
+		return res, errors.Wrap(err, "failed to do request")
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(client.requestTimeout, cancel)
+
+	res, err := client.c.Do(req.WithContext(ctx))
+	if err != nil {
+		timer.Stop()
+		cancel()
+
+		return nil, errors.Wrap(err, "failed to do request")
+	}
+
+	res.Body = &idleBody{ReadCloser: res.Body, timer: timer, timeout: client.requestTimeout, cancel: cancel}
+
+	return res, nil
+}
+
+// get requests rawURL, see do.
+func (client *Client) get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, http.NoBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+
+	return client.do(req)
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/common"
+)
+
+const (
+	// DefaultRateLimit is how many metadata requests are sent per second
+	DefaultRateLimit = 5.0
+	// DefaultFileURLRateLimit is how many file url requests are sent per
+	// second, those are the ones Qobuz throttles first
+	DefaultFileURLRateLimit = 2.0
+
+	// pathFileURL is the endpoint with its own budget
+	pathFileURL = "track/getFileUrl"
+
+	// a 429 halves the rate, down to 1/rateMinDivisor of the limit. Without
+	// another 429 for rateRecovery the rate climbs back by a tenth of the
+	// limit.
+	rateMinDivisor = 16
+	rateRecovery   = 10 * time.Second
+	rateRecoverBy  = 10
+
+	// rateThrottleGrace ignores 429s right after a slowdown, they were sent
+	// before it
+	rateThrottleGrace = time.Second
+)
+
+// limiter is a token bucket holding up to a second's worth of requests. It
+// slows down when the server says requests come in too fast and speeds up
+// again once it stops saying so. A nil limiter doesn't limit.
+type limiter struct {
+	name  string
+	limit float64
+
+	mu          sync.Mutex
+	rate        float64
+	tokens      float64
+	last        time.Time
+	throttledAt time.Time
+	recoveredAt time.Time
+	pausedUntil time.Time
+}
+
+// newLimiter returns a limiter sending rate requests per second, nil when
+// rate isn't positive.
+func newLimiter(name string, rate float64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+
+	return &limiter{ //nolint:exhaustruct
+		name:        name,
+		limit:       rate,
+		rate:        rate,
+		tokens:      max(rate, 1),
+		last:        now,
+		recoveredAt: now,
+	}
+}
+
+// wait blocks until a request may be sent or ctx is done.
+func (l *limiter) wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+
+	now := time.Now()
+	l.refill(now)
+
+	// the token is taken right away, the balance going negative is what
+	// queues up the requests behind this one
+	l.tokens--
+
+	delay := time.Duration(0)
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+
+	delay = max(delay, l.pausedUntil.Sub(now))
+
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "cancelled while waiting for the rate limit")
+	}
+}
+
+// refill adds the tokens earned since the last call and lets the rate
+// recover. l.mu must be held.
+func (l *limiter) refill(now time.Time) {
+	for l.rate < l.limit && now.Sub(l.recoveredAt) >= rateRecovery {
+		l.rate = min(l.rate+l.limit/rateRecoverBy, l.limit)
+		l.recoveredAt = l.recoveredAt.Add(rateRecovery)
+
+		log.Debug().Msgf("%v rate recovered to %.2f requests/s", l.name, l.rate)
+	}
+
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, max(l.rate, 1))
+	l.last = now
+}
+
+// observe slows the limiter down when err says the server rate limited the
+// request, every request waits for its Retry-After.
+func (l *limiter) observe(err error) {
+	if l == nil || !errors.Is(err, common.ErrRateLimited) {
+		return
+	}
+
+	var retryAfter time.Duration
+
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) {
+		retryAfter = min(apiErr.RetryAfter, maxRetryAfter)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.refill(now)
+
+	if until := now.Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+
+	if now.Sub(l.throttledAt) < rateThrottleGrace {
+		return
+	}
+
+	l.rate = max(l.rate/2, l.limit/rateMinDivisor)
+	l.tokens = min(l.tokens, 0)
+	l.throttledAt, l.recoveredAt = now, now
+
+	log.Warn().Msgf("rate limited, slowing %v requests down to %.2f/s", l.name, l.rate)
+}
+
+// limiter returns the budget requests to path are taken from.
+func (client *Client) limiter(path string) *limiter {
+	if path == pathFileURL {
+		return client.fileURLLimit
+	}
+
+	return client.metadataLimit
+}
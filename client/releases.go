@@ -0,0 +1,111 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/responses"
+)
+
+type ReleaseType string
+
+const (
+	ReleaseAlbum       ReleaseType = "album"
+	ReleaseEP          ReleaseType = "ep" // EPs and singles
+	ReleaseLive        ReleaseType = "live"
+	ReleaseCompilation ReleaseType = "compilation"
+	ReleaseAppearsOn   ReleaseType = "appears-on" // releases of other artists
+)
+
+//nolint:gochecknoglobals
+var (
+	AllReleaseTypes     = []ReleaseType{ReleaseAlbum, ReleaseEP, ReleaseLive, ReleaseCompilation, ReleaseAppearsOn}
+	DefaultReleaseTypes = []ReleaseType{ReleaseAlbum, ReleaseEP, ReleaseLive, ReleaseCompilation}
+)
+
+// ReleaseFilter picks the releases downloaded from an artist's discography.
+type ReleaseFilter struct {
+	// Types to download, nil means DefaultReleaseTypes.
+	Types []ReleaseType
+	// Unofficial also downloads releases Qobuz doesn't flag as official.
+	Unofficial bool
+}
+
+// ParseReleaseTypes parses a comma separated list such as "album,ep", "all"
+// expands to every release type.
+func ParseReleaseTypes(list string) ([]ReleaseType, error) {
+	types := make([]ReleaseType, 0)
+
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		switch name {
+		case "":
+			continue
+		case "all":
+			types = append(types, AllReleaseTypes...)
+		case "single":
+			types = append(types, ReleaseEP)
+		default:
+			found := false
+
+			for _, releaseType := range AllReleaseTypes {
+				if string(releaseType) == name {
+					types, found = append(types, releaseType), true
+				}
+			}
+
+			if !found {
+				return nil, errors.Wrapf(common.ErrInvalidArgs, "unknown release type %q", name)
+			}
+		}
+	}
+
+	if len(types) == 0 {
+		return nil, errors.Wrap(common.ErrInvalidArgs, "empty release types")
+	}
+
+	return types, nil
+}
+
+// releaseTypeOf classifies album as seen from the artist's discography.
+func releaseTypeOf(album *responses.Album, artistID int) ReleaseType {
+	if album.Artist == nil || album.Artist.ID != artistID {
+		return ReleaseAppearsOn
+	}
+
+	switch strings.ToLower(album.ReleaseType) {
+	case "single", "epmini", "ep", "epsingle":
+		return ReleaseEP
+	case "live":
+		return ReleaseLive
+	case "compilation":
+		return ReleaseCompilation
+	default:
+		return ReleaseAlbum
+	}
+}
+
+// Match reports whether album, listed in the discography of artistID, passes
+// the filter.
+func (filter ReleaseFilter) Match(album *responses.Album, artistID int) bool {
+	if !album.IsOfficial && !filter.Unofficial {
+		return false
+	}
+
+	types := filter.Types
+	if len(types) == 0 {
+		types = DefaultReleaseTypes
+	}
+
+	releaseType := releaseTypeOf(album, artistID)
+
+	for _, t := range types {
+		if t == releaseType {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/trevorstarick/qobuz-sync/common"
+)
+
+const (
+	// DefaultRetries is how many times a request is retried at most
+	DefaultRetries = 4
+	// DefaultRetryBudget is how many retries a whole run may spend
+	DefaultRetryBudget = 100
+
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+
+	// maxRetryAfter is the longest Retry-After that is waited for, a
+	// request asked to wait longer fails instead
+	maxRetryAfter = 5 * time.Minute
+
+	// errorBodyLimit is how much of an error response is read for its message
+	errorBodyLimit = 4096
+)
+
+// retrier decides whether a failed request is tried again and waits before
+// it is. Retries are limited per request and, through budget, per run.
+type retrier struct {
+	retries int
+	budget  atomic.Int64
+}
+
+func newRetrier(retries, budget int) *retrier {
+	r := &retrier{retries: retries} //nolint:exhaustruct
+	r.budget.Store(int64(budget))
+
+	return r
+}
+
+// backoff returns nil once it is time for the next attempt, or the error to
+// give up with. attempt counts from 1.
+func (r *retrier) backoff(ctx context.Context, attempt int, err error) error {
+	if !retryable(ctx, err) {
+		return err
+	}
+
+	if attempt > r.retries {
+		return errors.Wrapf(err, "giving up after %d attempts", attempt)
+	}
+
+	delay := retryDelay(attempt, err)
+	if delay > maxRetryAfter {
+		return errors.Wrapf(err, "asked to retry after %v", delay)
+	}
+
+	if r.budget.Add(-1) < 0 {
+		return errors.Wrap(err, "retry budget exhausted")
+	}
+
+	log.Warn().Err(err).Msgf("retrying in %v (%d/%d)", delay.Round(time.Millisecond), attempt, r.retries)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "cancelled while waiting to retry")
+	}
+}
+
+// retryDelay honours Retry-After and otherwise backs off exponentially with
+// jitter, so that parallel workers don't retry in lockstep.
+func retryDelay(attempt int, err error) time.Duration {
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+
+	// the shift is capped so that many retries can't overflow the delay
+	delay := min(retryBaseDelay<<min(attempt-1, 16), retryMaxDelay)
+
+	return delay/2 + rand.N(delay/2+1) //nolint:gosec // jitter doesn't need a secure source
+}
+
+// retryable reports whether err is worth another attempt: rate limits,
+// server errors, dropped connections and timeouts. Nothing is retried once
+// ctx is done.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, common.ErrRateLimited), errors.Is(err, common.ErrServerError):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, syscall.ECONNRESET):
+		return true
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// ctx is still live, so it was the request timeout
+		return true
+	case errors.As(err, &netErr):
+		return true
+	default:
+		return false
+	}
+}
+
+// statusError turns an unexpected status into an error matching one of the
+// common sentinels. Qobuz explains errors in a json message.
+func statusError(res *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+
+	buf, _ := io.ReadAll(io.LimitReader(res.Body, errorBodyLimit))
+	_ = json.Unmarshal(buf, &body)
+
+	apiErr := &common.APIError{
+		Err:        nil,
+		Status:     res.StatusCode,
+		Message:    body.Message,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After")),
+	}
+
+	message := strings.ToLower(body.Message)
+
+	switch {
+	case res.StatusCode == http.StatusBadRequest:
+		apiErr.Err = common.ErrBadRequest
+	case res.StatusCode == http.StatusUnauthorized:
+		apiErr.Err = common.ErrAuthFailed
+	case res.StatusCode == http.StatusNotFound:
+		apiErr.Err = common.ErrNotFound
+	case res.StatusCode == http.StatusTooManyRequests:
+		apiErr.Err = common.ErrRateLimited
+	case res.StatusCode >= http.StatusInternalServerError:
+		apiErr.Err = common.ErrServerError
+	case strings.Contains(message, "country"), strings.Contains(message, "region"),
+		strings.Contains(message, "territor"), res.StatusCode == http.StatusUnavailableForLegalReasons:
+		apiErr.Err = common.ErrGeoRestricted
+	case strings.Contains(message, "subscri"), strings.Contains(message, "eligible"),
+		strings.Contains(message, "offer"), res.StatusCode == http.StatusPaymentRequired:
+		apiErr.Err = common.ErrSubscriptionRequired
+	default:
+		return errors.Errorf("invalid status code: %d: %v", res.StatusCode, body.Message)
+	}
+
+	return apiErr
+}
+
+// parseRetryAfter reads a Retry-After header, either seconds or a date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
+
+// fetch gets rawURL and retries transient failures, only a 200 response is
+// returned.
+func (client *Client) fetch(ctx context.Context, rawURL string) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := client.get(ctx, rawURL)
+		if err == nil && res.StatusCode != http.StatusOK {
+			err = statusError(res)
+			res.Body.Close()
+		}
+
+		if err == nil {
+			return res, nil
+		}
+
+		if err := client.retry.backoff(ctx, attempt, err); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/trevorstarick/qobuz-sync/common"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	storeFile = "qobuz-sync.db"
+
+	bucketAlbums    = "albums"
+	bucketTracks    = "tracks"
+	bucketPlaylists = "playlists"
+	bucketGoodies   = "goodies"
+	bucketLabels    = "labels"
+	bucketFavorites = "favorites"
+	bucketSync      = "sync"
+	bucketArtists   = "artists"
+
+	// bucketPlaylistTracks holds the state of every synced playlist, see
+	// playlistState
+	bucketPlaylistTracks = "playlist_tracks"
+	// bucketPlaylistCovers holds what every playlist cover was made from
+	bucketPlaylistCovers = "playlist_covers"
+	// bucketParts holds the stream every .part file is a prefix of, keyed
+	// by its path, see partInfo
+	bucketParts = "parts"
+)
+
+// Store is the embedded database that records everything that was downloaded.
+// Every kind of item lives in its own bucket, keyed by its Qobuz ID.
+type Store struct {
+	db *bolt.DB
+}
+
+func OpenStore(baseDir string) (*Store, error) {
+	db, err := bolt.Open(filepath.Join(baseDir, storeFile), common.FilePerm, &bolt.Options{ //nolint:exhaustruct
+		Timeout: time.Second,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open database")
+	}
+
+	store := &Store{db: db}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{bucketAlbums, bucketTracks, bucketPlaylists, bucketGoodies} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return errors.Wrapf(err, "unable to create %v bucket", bucket)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+
+		return nil, errors.Wrap(err, "unable to initialise database")
+	}
+
+	for bucket, file := range map[string]string{
+		bucketTracks: "tracks.txt",
+		bucketAlbums: "albums.txt",
+	} {
+		err = store.migrateTextTracker(bucket, filepath.Join(baseDir, file))
+		if err != nil {
+			_ = db.Close()
+
+			return nil, errors.Wrapf(err, "unable to migrate %v", file)
+		}
+	}
+
+	return store, nil
+}
+
+// Tracker returns a tracker backed by the given bucket.
+func (store *Store) Tracker(bucket string) *Tracker {
+	return &Tracker{
+		db:     store.db,
+		bucket: []byte(bucket),
+	}
+}
+
+// get decodes the value stored under key in bucket into v and reports
+// whether the key existed.
+func (store *Store) get(bucket, key string, v any) (bool, error) {
+	found := false
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		buf := b.Get([]byte(key))
+		if buf == nil {
+			return nil
+		}
+
+		found = true
+
+		return errors.Wrap(json.Unmarshal(buf, v), "unable to decode value")
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "unable to read database")
+	}
+
+	return found, nil
+}
+
+// put stores v under key in bucket, creating the bucket when needed.
+func (store *Store) put(bucket, key string, v any) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode value")
+	}
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return errors.Wrap(err, "unable to create bucket")
+		}
+
+		return errors.Wrap(b.Put([]byte(key), buf), "unable to write value")
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to write database")
+	}
+
+	return nil
+}
+
+// delete removes key from bucket, missing keys and buckets are ignored.
+func (store *Store) delete(bucket, key string) error {
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		return errors.Wrap(b.Delete([]byte(key)), "unable to delete value")
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to write database")
+	}
+
+	return nil
+}
+
+// keys returns the keys of bucket that start with prefix.
+func (store *Store) keys(bucket, prefix string) ([]string, error) {
+	keys := make([]string, 0)
+
+	err := store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+
+		c := b.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read database")
+	}
+
+	return keys, nil
+}
+
+func (store *Store) Close() error {
+	err := store.db.Close()
+	if err != nil {
+		return errors.Wrap(err, "unable to close database")
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+// migrateTextTracker imports one of the old "key: path" text trackers into
+// bucket and renames it so the import only ever happens once. Keys already
+// in the database win over the text file.
+func (store *Store) migrateTextTracker(bucket, path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return errors.Wrap(err, "unable to read file")
+	}
+
+	entries := parseTextTracker(string(buf))
+
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+
+		for key, entry := range entries {
+			if b.Get([]byte(key)) != nil {
+				continue
+			}
+
+			value, err := json.Marshal(entry)
+			if err != nil {
+				return errors.Wrap(err, "unable to marshal entry")
+			}
+
+			if err := b.Put([]byte(key), value); err != nil {
+				return errors.Wrap(err, "unable to put entry")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to import entries")
+	}
+
+	err = os.Rename(path, path+".migrated")
+	if err != nil {
+		return errors.Wrap(err, "unable to rename migrated file")
+	}
+
+	log.Info().Msgf("migrated %d entries from %v", len(entries), path)
+
+	return nil
+}
+
+// parseTextTracker reads the old tracker format, one "key: path" per line,
+// later lines replace earlier ones. Entries whose file no longer exists are
+// dropped.
+func parseTextTracker(data string) map[string]TrackerEntry {
+	entries := make(map[string]TrackerEntry)
+
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" {
+			continue
+		}
+
+		// keys are Qobuz IDs so the first delimiter always ends the key,
+		// even when the path itself contains one
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			log.Warn().Msgf("invalid line in tracker file: %v", line)
+
+			continue
+		}
+
+		entry := TrackerEntry{Path: value} //nolint:exhaustruct
+
+		info, err := os.Stat(entry.Path)
+		if err != nil {
+			log.Warn().Msgf("unable to stat file, not migrating: %v (%v)", entry.Path, err)
+
+			continue
+		}
+
+		if info.Mode().IsRegular() {
+			entry.Size = info.Size()
+		}
+
+		entry.DownloadedAt = info.ModTime().UTC().Truncate(time.Second)
+
+		entries[key] = entry
+	}
+
+	return entries
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Keys of the sync bucket, one per list that is synced incrementally.
+const (
+	syncFavoriteAlbums = "favorite_albums"
+	syncFavoriteTracks = "favorite_tracks"
+)
+
+// syncState is what a previous sync of a list saw.
+type syncState struct {
+	// LastUpdate is the list's last_update reported at login
+	LastUpdate int `json:"last_update"`
+	// FavoritedAt is the newest favorited_at that was processed
+	FavoritedAt int       `json:"favorited_at"`
+	SyncedAt    time.Time `json:"synced_at"`
+}
+
+// loadSyncState returns the state of the last sync of key, or a zero state
+// when resyncing or never synced.
+func (client *Client) loadSyncState(key string) (syncState, error) {
+	var state syncState
+
+	if client.resync {
+		return state, nil
+	}
+
+	_, err := client.store.get(bucketSync, key, &state)
+	if err != nil {
+		return state, errors.Wrap(err, "unable to get sync state")
+	}
+
+	return state, nil
+}
+
+func (client *Client) saveSyncState(key string, state syncState) error {
+	state.SyncedAt = time.Now()
+
+	return errors.Wrap(client.store.put(bucketSync, key, state), "unable to save sync state")
+}
+
+// unchanged reports whether lastUpdate proves the list didn't change since
+// state was saved. A zero lastUpdate proves nothing.
+func (state syncState) unchanged(lastUpdate int) bool {
+	return lastUpdate != 0 && state.LastUpdate == lastUpdate
+}
+
+// isNew reports whether an item favorited at favoritedAt wasn't processed by
+// the last sync.
+func (state syncState) isNew(favoritedAt int) bool {
+	return favoritedAt == 0 || favoritedAt > state.FavoritedAt
+}
+
+// recordFavorite remembers when an item was favorited.
+func (client *Client) recordFavorite(kind, id string, favoritedAt int) {
+	err := client.store.put(bucketFavorites, kind+"/"+id, favoritedAt)
+	if err != nil {
+		log.Warn().Err(err).Msgf("unable to record favorite %v/%v", kind, id)
+	}
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/frolovo22/tag"
+	"github.com/pkg/errors"
+	"github.com/trevorstarick/qobuz-sync/common"
+)
+
+const (
+	// id3v24Separator splits multiple values of a text frame
+	id3v24Separator = "\x00"
+	// id3v23Separator is what most players expect since v2.3 has no separator
+	id3v23Separator = "/"
+)
+
+// tagField is a vorbis comment name with one or more values, fields without
+// a value are not written.
+type tagField struct {
+	name   string
+	values []string
+}
+
+// id3Frames maps the vorbis comment names with a standard ID3v2 frame, the
+// rest is written as TXXX frames.
+//
+//nolint:gochecknoglobals
+var id3Frames = map[string]string{
+	"ARTIST":          "TPE1",
+	"COMPOSER":        "TCOM",
+	"CONDUCTOR":       "TPE3",
+	"LYRICIST":        "TEXT",
+	"GENRE":           "TCON",
+	"ISRC":            "TSRC",
+	"LABEL":           "TPUB",
+	"COPYRIGHT":       "TCOP",
+	"ALBUMARTISTSORT": "TSO2",
+	"ARTISTSORT":      "TSOP",
+	"SUBTITLE":        "TIT3",
+}
+
+// tagFields returns the tags the tag library has no setter for.
+func tagFields(tags common.Metadata) []tagField {
+	single := func(name, value string) tagField {
+		if value == "" {
+			return tagField{name: name, values: nil}
+		}
+
+		return tagField{name: name, values: []string{value}}
+	}
+
+	advisory := "0"
+	if tags.Explicit {
+		advisory = "1"
+	}
+
+	fields := []tagField{
+		{name: "ARTIST", values: tags.Artists},
+		{name: "COMPOSER", values: tags.Composers},
+		{name: "CONDUCTOR", values: tags.Conductors},
+		{name: "PRODUCER", values: tags.Producers},
+		{name: "MIXER", values: tags.Mixers},
+		{name: "LYRICIST", values: tags.Lyricists},
+		{name: "GENRE", values: tags.Genres},
+		single("ALBUMARTISTSORT", tags.AlbumArtistSort),
+		single("ARTISTSORT", tags.ArtistSort),
+		single("VERSION", tags.Version),
+		single("SUBTITLE", tags.Version),
+		single("ISRC", tags.ISRC),
+		single("BARCODE", tags.Barcode),
+		single("UPC", tags.Barcode),
+		single("LABEL", tags.Label),
+		single("COPYRIGHT", tags.Copyright),
+		single("ITUNESADVISORY", advisory),
+		single("QOBUZ_TRACK_ID", tags.QobuzTrackID),
+		single("QOBUZ_ALBUM_ID", tags.QobuzAlbumID),
+	}
+
+	instruments := make([]string, 0, len(tags.Performers))
+	for instrument := range tags.Performers {
+		instruments = append(instruments, instrument)
+	}
+
+	sort.Strings(instruments)
+
+	for _, instrument := range instruments {
+		fields = append(fields, tagField{
+			name:   "PERFORMER:" + strings.ReplaceAll(instrument, "=", ""),
+			values: tags.Performers[instrument],
+		})
+	}
+
+	if tags.ReplayGainTrackPeak != 0 {
+		fields = append(fields,
+			single("REPLAYGAIN_TRACK_GAIN", fmt.Sprintf("%.2f dB", tags.ReplayGainTrackGain)),
+			single("REPLAYGAIN_TRACK_PEAK", fmt.Sprintf("%.6f", tags.ReplayGainTrackPeak)),
+		)
+	}
+
+	return slices.DeleteFunc(fields, func(field tagField) bool {
+		return len(field.values) == 0
+	})
+}
+
+func setID3Fields(
+	setString, setStringTXXX func(name, value string) error,
+	fields []tagField,
+	separator string,
+) {
+	for _, field := range fields {
+		value := strings.Join(field.values, separator)
+
+		if frame, ok := id3Frames[field.name]; ok {
+			_ = setString(frame, value)
+		} else {
+			_ = setStringTXXX(field.name, value)
+		}
+	}
+}
+
+// saveFLAC writes the file with its vorbis comments and fields. The tag
+// library keeps one value per name, so the comment block is built here. The
+// file is replaced atomically, a failed write never leaves a truncated file
+// behind.
+func saveFLAC(flac *tag.FLAC, fields []tagField, path string) error {
+	comments := make([]tag.VorbisComment, 0, len(flac.Tags)+len(fields))
+
+	names := make([]string, 0, len(flac.Tags))
+	for name := range flac.Tags {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		overridden := slices.ContainsFunc(fields, func(field tagField) bool {
+			return field.name == name
+		})
+
+		if flac.Tags[name] != "" && !overridden {
+			comments = append(comments, tag.VorbisComment{Name: name, Value: flac.Tags[name]})
+		}
+	}
+
+	for _, field := range fields {
+		for _, value := range field.values {
+			comments = append(comments, tag.VorbisComment{Name: field.name, Value: value})
+		}
+	}
+
+	blocks := slices.DeleteFunc(slices.Clone(flac.Blocks), func(block *tag.FlacMetadataBlock) bool {
+		return block.Type == tag.FlacVorbisComment
+	})
+
+	data := vorbisCommentBlock(flac.Vendor, comments)
+	blocks = append(blocks, &tag.FlacMetadataBlock{
+		IsLast: false,
+		Type:   tag.FlacVorbisComment,
+		Size:   len(data),
+		Data:   data,
+	})
+
+	return writeFileAtomic(path, func(w io.Writer) error {
+		if _, err := io.WriteString(w, tag.FLACIdentifier); err != nil {
+			return errors.Wrap(err, "failed to write header")
+		}
+
+		for i, block := range blocks {
+			if err := block.Write(w, i == len(blocks)-1); err != nil {
+				return errors.Wrap(err, "failed to write metadata block")
+			}
+		}
+
+		_, err := w.Write(flac.Data)
+
+		return errors.Wrap(err, "failed to write audio")
+	})
+}
+
+// vorbisCommentBlock encodes a VORBIS_COMMENT block, every length is a
+// little endian uint32.
+func vorbisCommentBlock(vendor string, comments []tag.VorbisComment) []byte {
+	buf := new(bytes.Buffer)
+
+	writeString := func(s string) {
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(s))) //nolint:gosec
+		buf.WriteString(s)
+	}
+
+	writeString(vendor)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(comments))) //nolint:gosec
+
+	for _, comment := range comments {
+		writeString(comment.Name + "=" + comment.Value)
+	}
+
+	return buf.Bytes()
+}
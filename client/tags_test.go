@@ -0,0 +1,189 @@
+package client
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/frolovo22/tag"
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
+	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/helpers"
+)
+
+// fixtureAudio stands in for the audio frames, nothing here decodes them.
+var fixtureAudio = []byte{0xff, 0xf8, 0x69, 0x08, 0x00, 0x00, 0x42} //nolint:gochecknoglobals
+
+// writeFLACFixture writes a 16-bit 44.1kHz stereo FLAC with the given
+// vorbis comments and cover picture, as a downloaded .part file looks.
+func writeFLACFixture(t *testing.T, path string, comments []tag.VorbisComment, cover *common.Picture) {
+	t.Helper()
+
+	streamInfo := make([]byte, 34)
+	// minimum and maximum block size of 4096 samples
+	copy(streamInfo, []byte{0x10, 0x00, 0x10, 0x00})
+	// sample rate (20 bits), channels - 1 (3 bits), bits per sample - 1 (5 bits)
+	packed := uint64(44100)<<44 | uint64(1)<<41 | uint64(15)<<36
+	for i := range 8 {
+		streamInfo[10+i] = byte(packed >> (56 - 8*i))
+	}
+
+	blocks := []*tag.FlacMetadataBlock{
+		{Type: tag.FlacStreamInfo, Size: len(streamInfo), Data: streamInfo},
+	}
+
+	comment := vorbisCommentBlock("reference libFLAC 1.4.3 20230623", comments)
+	blocks = append(blocks, &tag.FlacMetadataBlock{Type: tag.FlacVorbisComment, Size: len(comment), Data: comment})
+
+	picture := flacPictureBlock(cover)
+	blocks = append(blocks, &tag.FlacMetadataBlock{Type: tag.FlacPicture, Size: len(picture), Data: picture})
+
+	buf := bytes.NewBufferString(tag.FLACIdentifier)
+
+	for i, block := range blocks {
+		if err := block.Write(buf, i == len(blocks)-1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf.Write(fixtureAudio)
+
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetTagsFLAC(t *testing.T) {
+	t.Parallel()
+
+	existing := &common.Picture{MIME: helpers.MimePNG, Width: 1, Height: 1, Data: []byte("existing cover")}
+	replacement := &common.Picture{MIME: helpers.MimeJPEG, Width: 2, Height: 2, Data: []byte("replacement cover")}
+
+	tests := []struct {
+		name    string
+		cover   *common.Picture
+		picture *common.Picture
+	}{
+		{name: "keeps the existing picture", cover: nil, picture: existing},
+		{name: "replaces the existing picture", cover: replacement, picture: replacement},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "01 - Get Lucky.flac")
+
+			writeFLACFixture(t, path+".part", []tag.VorbisComment{
+				{Name: "TITLE", Value: "stale title"},
+				{Name: "ARTIST", Value: "stale artist"},
+				{Name: "ENCODER", Value: "reference libFLAC 1.4.3"},
+			}, existing)
+
+			metadata := common.Metadata{ //nolint:exhaustruct
+				Album:        "Random Access Memories",
+				AlbumArtist:  "Daft Punk",
+				Artist:       "Daft Punk",
+				Title:        "Get Lucky",
+				Track:        8,
+				TrackTotal:   13,
+				Disc:         1,
+				DiscTotal:    1,
+				Genre:        "Pop",
+				Genres:       []string{"Pop", "Dance"},
+				Artists:      []string{"Daft Punk", "Pharrell Williams", "Nile Rodgers"},
+				Composers:    []string{"Thomas Bangalter", "Guy-Manuel de Homem-Christo"},
+				Performers:   map[string][]string{"guitar": {"Nile Rodgers"}, "vocals": {"Pharrell Williams", "Nile Rodgers"}},
+				ISRC:         "USQX91300108",
+				QobuzTrackID: "19512574",
+				QobuzAlbumID: "0886443927087",
+				Cover:        test.cover,
+			}
+
+			if err := SetTags(path+".part", metadata); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+				t.Errorf("part file left behind: %v", err)
+			}
+
+			// the tag library keeps one value per name, mewkiz/flac keeps them all
+			stream, err := flac.ParseFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer stream.Close()
+
+			values := make(map[string][]string)
+			pictures := make([]*meta.Picture, 0)
+
+			for _, block := range stream.Blocks {
+				switch body := block.Body.(type) {
+				case *meta.VorbisComment:
+					for _, comment := range body.Tags {
+						values[comment[0]] = append(values[comment[0]], comment[1])
+					}
+				case *meta.Picture:
+					pictures = append(pictures, body)
+				}
+			}
+
+			for name, want := range map[string][]string{
+				"TITLE":            {"Get Lucky"},
+				"ENCODER":          {"reference libFLAC 1.4.3"},
+				"ARTIST":           {"Daft Punk", "Pharrell Williams", "Nile Rodgers"},
+				"COMPOSER":         {"Thomas Bangalter", "Guy-Manuel de Homem-Christo"},
+				"GENRE":            {"Pop", "Dance"},
+				"PERFORMER:guitar": {"Nile Rodgers"},
+				"PERFORMER:vocals": {"Pharrell Williams", "Nile Rodgers"},
+				"ISRC":             {"USQX91300108"},
+				"QOBUZ_TRACK_ID":   {"19512574"},
+			} {
+				if !slices.Equal(values[name], want) {
+					t.Errorf("got %v %q, want %q", name, values[name], want)
+				}
+			}
+
+			if stream.Info.SampleRate != 44100 || stream.Info.BitsPerSample != 16 {
+				t.Errorf("got STREAMINFO %d Hz %d-bit, want 44100 Hz 16-bit",
+					stream.Info.SampleRate, stream.Info.BitsPerSample)
+			}
+
+			if len(pictures) != 1 {
+				t.Fatalf("got %d pictures, want 1", len(pictures))
+			}
+
+			if pictures[0].MIME != test.picture.MIME || !bytes.Equal(pictures[0].Data, test.picture.Data) {
+				t.Errorf("got %v picture %q, want %v %q",
+					pictures[0].MIME, pictures[0].Data, test.picture.MIME, test.picture.Data)
+			}
+
+			fileTags, err := tag.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			flacTags, ok := fileTags.(*tag.FLAC)
+			if !ok {
+				t.Fatalf("read back as %T, want *tag.FLAC", fileTags)
+			}
+
+			if title, _ := flacTags.GetTitle(); title != "Get Lucky" {
+				t.Errorf("got title %q, want %q", title, "Get Lucky")
+			}
+
+			if number, total, _ := flacTags.GetTrackNumber(); number != 8 || total != 13 {
+				t.Errorf("got track %d/%d, want 8/13", number, total)
+			}
+
+			if !bytes.Equal(flacTags.Data, fixtureAudio) {
+				t.Errorf("audio changed: got %x, want %x", flacTags.Data, fixtureAudio)
+			}
+		})
+	}
+}
@@ -1,103 +1,221 @@
 package client
 
 import (
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
 	"os"
-	"strings"
+	"time"
 
 	"github.com/pkg/errors"
-	"github.com/rs/zerolog/log"
-	"github.com/trevorstarick/qobuz-sync/common"
+	trackGetFileUrl "github.com/trevorstarick/qobuz-sync/responses/track/getFileUrl"
+	bolt "go.etcd.io/bbolt"
 )
 
-type Tracker struct {
-	cache map[string]string
-	file  *os.File
+// TrackerEntry is what the tracker knows about a downloaded item. Entries
+// migrated from the old text trackers only have a Path and Size.
+type TrackerEntry struct {
+	Path         string    `json:"path"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+	Size         int64     `json:"size,omitempty"`
+	Checksum     string    `json:"checksum,omitempty"` // sha256 of the file
+
+	FormatID     int     `json:"format_id,omitempty"`
+	BitDepth     int     `json:"bit_depth,omitempty"`
+	SamplingRate float64 `json:"sampling_rate,omitempty"`
+	MimeType     string  `json:"mime_type,omitempty"`
+}
 
-	Path string `json:"path"`
+func newTrackerEntry(path string, url *trackGetFileUrl.Response) TrackerEntry {
+	return TrackerEntry{ //nolint:exhaustruct
+		Path:         path,
+		FormatID:     url.FormatID,
+		BitDepth:     url.BitDepth,
+		SamplingRate: url.SamplingRate,
+		MimeType:     url.MimeType,
+	}
 }
 
-func NewTracker(path string) (*Tracker, error) {
-	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, common.FilePerm)
+// HasFormat reports whether the entry recorded the delivered format.
+func (entry TrackerEntry) HasFormat() bool {
+	return entry.FormatID != 0
+}
+
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to open file")
+		return "", errors.Wrap(err, "unable to open file")
 	}
 
-	// defer file.Close() // handled by Tracker.Close()
+	defer file.Close()
 
-	tracker := &Tracker{
-		cache: make(map[string]string),
-		file:  file,
-		Path:  path,
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", errors.Wrap(err, "unable to hash file")
 	}
 
-	bytes, err := os.ReadFile(path)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to read file")
-	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Tracker is a view of one bucket of the Store.
+type Tracker struct {
+	db     *bolt.DB
+	bucket []byte
+}
 
-	for _, line := range strings.Split(string(bytes), "\n") {
-		if line == "" {
-			continue
+// Set records value as the path for key unless key is already tracked.
+func (tracker *Tracker) Set(key, value string) error {
+	err := tracker.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tracker.bucket)
+		if b.Get([]byte(key)) != nil {
+			return nil
 		}
 
-		delim := ": "
+		buf, err := json.Marshal(TrackerEntry{ //nolint:exhaustruct
+			Path:         value,
+			DownloadedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal entry")
+		}
 
-		index := strings.Index(line, delim)
-		if index == -1 {
-			log.Warn().Msgf("invalid line in tracker file: %v", line)
+		return errors.Wrap(b.Put([]byte(key), buf), "unable to put entry")
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to write to database")
+	}
 
-			continue
-		}
+	return nil
+}
 
-		trackOrAlbumID := line[:index]
-		path := line[index+len(delim):]
+// SetEntry records entry for key, replacing any existing entry. Size and
+// checksum are filled in from the file when the entry points at one.
+func (tracker *Tracker) SetEntry(key string, entry TrackerEntry) error {
+	if entry.DownloadedAt.IsZero() {
+		entry.DownloadedAt = time.Now().UTC()
+	}
 
-		_, err := os.Stat(path)
-		if err != nil {
-			log.Warn().Msgf("unable to stat file: %v (%v)", path, err)
+	if info, err := os.Stat(entry.Path); err == nil && info.Mode().IsRegular() {
+		entry.Size = info.Size()
 
-			continue
+		if entry.Checksum == "" {
+			entry.Checksum, err = fileChecksum(entry.Path)
+			if err != nil {
+				return err
+			}
 		}
-
-		tracker.cache[trackOrAlbumID] = path
 	}
 
-	return tracker, nil
+	return tracker.put(key, entry)
 }
 
-func (tracker *Tracker) Set(key, value string) error {
-	if _, ok := tracker.cache[key]; ok {
-		return nil
+func (tracker *Tracker) put(key string, entry TrackerEntry) error {
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal entry")
 	}
 
-	tracker.cache[key] = value
-
-	_, err := tracker.file.WriteString(fmt.Sprintf("%s: %s\n", key, value))
+	err = tracker.db.Update(func(tx *bolt.Tx) error {
+		return errors.Wrap(tx.Bucket(tracker.bucket).Put([]byte(key), buf), "unable to put entry")
+	})
 	if err != nil {
-		return errors.Wrap(err, "unable to write to file")
+		return errors.Wrap(err, "unable to write to database")
 	}
 
 	return nil
 }
 
 func (tracker *Tracker) Get(key string) (string, error) {
-	if v, ok := tracker.cache[key]; ok {
-		if _, err := os.Stat(v); err != nil {
-			return "", errors.Wrap(err, "unable to stat file")
+	entry, err := tracker.GetEntry(key)
+	if err != nil {
+		return "", err
+	}
+
+	return entry.Path, nil
+}
+
+// GetEntry returns the entry for key if its path still exists on disk.
+func (tracker *Tracker) GetEntry(key string) (TrackerEntry, error) {
+	entry, err := tracker.lookup(key)
+	if err != nil {
+		return TrackerEntry{}, err //nolint:exhaustruct
+	}
+
+	if _, err := os.Stat(entry.Path); err != nil {
+		return TrackerEntry{}, errors.Wrap(err, "unable to stat file") //nolint:exhaustruct
+	}
+
+	return entry, nil
+}
+
+// lookup returns the entry for key without checking the filesystem.
+func (tracker *Tracker) lookup(key string) (TrackerEntry, error) {
+	var entry TrackerEntry
+
+	err := tracker.db.View(func(tx *bolt.Tx) error {
+		buf := tx.Bucket(tracker.bucket).Get([]byte(key))
+		if buf == nil {
+			return errors.New("key not found")
 		}
 
-		return v, nil
+		return errors.Wrap(json.Unmarshal(buf, &entry), "unable to unmarshal entry")
+	})
+	if err != nil {
+		return TrackerEntry{}, errors.Wrap(err, "unable to read from database") //nolint:exhaustruct
 	}
 
-	return "", errors.New("key not found")
+	return entry, nil
 }
 
-func (tracker *Tracker) Close() error {
-	err := tracker.file.Close()
+// Delete forgets key.
+func (tracker *Tracker) Delete(key string) error {
+	err := tracker.db.Update(func(tx *bolt.Tx) error {
+		return errors.Wrap(tx.Bucket(tracker.bucket).Delete([]byte(key)), "unable to delete entry")
+	})
 	if err != nil {
-		return errors.Wrap(err, "unable to close file")
+		return errors.Wrap(err, "unable to write to database")
 	}
 
 	return nil
 }
+
+// entries returns every tracked entry by key, read in one transaction and
+// without checking the filesystem.
+func (tracker *Tracker) entries() (map[string]TrackerEntry, error) {
+	entries := make(map[string]TrackerEntry)
+
+	err := tracker.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tracker.bucket).ForEach(func(k, v []byte) error {
+			var entry TrackerEntry
+
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return errors.Wrap(err, "unable to unmarshal entry")
+			}
+
+			entries[string(k)] = entry
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read from database")
+	}
+
+	return entries, nil
+}
+
+// Keys returns every tracked key in sorted order.
+func (tracker *Tracker) Keys() []string {
+	keys := make([]string, 0)
+
+	_ = tracker.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(tracker.bucket).ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+
+			return nil
+		})
+	})
+
+	return keys
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"bytes"
+	"crypto/md5" //nolint:gosec // FLAC stores an MD5 of the decoded audio
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/frolovo22/tag"
+	"github.com/mewkiz/flac"
+	"github.com/pkg/errors"
+	"github.com/trevorstarick/qobuz-sync/common"
+	"github.com/trevorstarick/qobuz-sync/helpers"
+)
+
+var errCorrupt = errors.New("corrupt audio file")
+
+// checkAudio validates the file signature and decodes the whole stream.
+func checkAudio(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to open file")
+	}
+
+	header := make([]byte, 4) //nolint:gomnd
+	_, err = io.ReadFull(file, header)
+
+	_ = file.Close()
+
+	if err != nil {
+		return errors.Wrap(errCorrupt, "file too short")
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".flac":
+		if !helpers.IsFLAC(header) {
+			return errors.Wrap(errCorrupt, "missing fLaC signature")
+		}
+
+		return checkFLAC(path)
+	case ".mp3":
+		if !helpers.IsMP3(header) {
+			return errors.Wrap(errCorrupt, "missing ID3/MPEG signature")
+		}
+
+		return checkMP3(path)
+	default:
+		return errors.Wrapf(errCorrupt, "unknown extension %v", filepath.Ext(path))
+	}
+}
+
+// checkFLAC decodes every frame (which checks their CRCs) and compares the
+// MD5 of the decoded samples with the one stored in STREAMINFO.
+func checkFLAC(path string) error {
+	stream, err := flac.Open(path)
+	if err != nil {
+		return errors.Wrapf(errCorrupt, "invalid stream: %v", err)
+	}
+
+	defer stream.Close()
+
+	sum := md5.New() //nolint:gosec
+	samples := uint64(0)
+
+	for {
+		frame, err := stream.ParseNext()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return errors.Wrapf(errCorrupt, "frame at sample %d: %v", samples, err)
+		}
+
+		frame.Hash(sum)
+		samples += uint64(frame.BlockSize)
+	}
+
+	if stream.Info.NSamples != 0 && samples != stream.Info.NSamples {
+		return errors.Wrapf(errCorrupt, "truncated, %d of %d samples", samples, stream.Info.NSamples)
+	}
+
+	// an all zero MD5 means the encoder didn't compute one
+	if stream.Info.MD5sum != [md5.Size]uint8{} && !bytes.Equal(sum.Sum(nil), stream.Info.MD5sum[:]) {
+		return errors.Wrap(errCorrupt, "STREAMINFO MD5 mismatch")
+	}
+
+	return nil
+}
+
+//nolint:gochecknoglobals,gomnd
+var (
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, -1}, // MPEG-1
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, -1},     // MPEG-2/2.5
+	}
+	mp3SampleRates = [3]int{44100, 48000, 32000}
+)
+
+// mp3FrameSize returns the length of the MPEG layer III frame starting with
+// header, or 0 when header is not a valid frame header.
+//
+//nolint:gomnd
+func mp3FrameSize(header []byte) int {
+	if header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return 0
+	}
+
+	version := (header[1] >> 3) & 0x03 // 0: 2.5, 2: 2, 3: 1
+	layer := (header[1] >> 1) & 0x03   // 1: layer III
+	bitrateIndex := header[2] >> 4
+	sampleRateIndex := (header[2] >> 2) & 0x03
+	padding := int((header[2] >> 1) & 0x01)
+
+	if version == 1 || layer != 1 || sampleRateIndex == 3 {
+		return 0
+	}
+
+	table, coefficient, sampleRate := 0, 144, mp3SampleRates[sampleRateIndex]
+
+	switch version {
+	case 2:
+		table, coefficient, sampleRate = 1, 72, sampleRate/2
+	case 0:
+		table, coefficient, sampleRate = 1, 72, sampleRate/4
+	}
+
+	bitrate := mp3Bitrates[table][bitrateIndex]
+	if bitrate <= 0 {
+		return 0
+	}
+
+	return coefficient*bitrate*1000/sampleRate + padding
+}
+
+// checkMP3 walks every MPEG frame after the ID3v2 tag and fails when a frame
+// header is invalid or the last frame runs past the end of the file.
+//
+//nolint:gomnd
+func checkMP3(path string) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to read file")
+	}
+
+	offset := 0
+
+	if bytes.HasPrefix(buf, []byte("ID3")) && len(buf) >= 10 {
+		size := int(buf[6])<<21 | int(buf[7])<<14 | int(buf[8])<<7 | int(buf[9])
+		offset = 10 + size
+
+		if buf[5]&0x10 != 0 { // footer present
+			offset += 10
+		}
+	}
+
+	frames := 0
+
+	for offset+4 <= len(buf) {
+		rest := buf[offset:]
+		if bytes.HasPrefix(rest, []byte("APETAGEX")) || (bytes.HasPrefix(rest, []byte("TAG")) && len(rest) == 128) {
+			break
+		}
+
+		size := mp3FrameSize(rest)
+		if size == 0 {
+			return errors.Wrapf(errCorrupt, "invalid frame header at byte %d", offset)
+		}
+
+		if offset+size > len(buf) {
+			return errors.Wrapf(errCorrupt, "truncated frame at byte %d", offset)
+		}
+
+		offset += size
+		frames++
+	}
+
+	if frames == 0 {
+		return errors.Wrap(errCorrupt, "no audio frames")
+	}
+
+	return nil
+}
+
+// compareTags returns the names of the tags in path that differ from want.
+func compareTags(path string, want common.Metadata) ([]string, error) {
+	fileTags, err := tag.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read tags")
+	}
+
+	title, _ := fileTags.GetTitle()
+	album, _ := fileTags.GetAlbum()
+	artist, _ := fileTags.GetArtist()
+	albumArtist, _ := fileTags.GetAlbumArtist()
+	track, _, _ := fileTags.GetTrackNumber()
+
+	mismatched := make([]string, 0)
+
+	for _, field := range []struct {
+		name      string
+		got, want string
+	}{
+		{"title", title, want.Title},
+		{"album", album, want.Album},
+		{"artist", artistTag(artist, want), want.Artist},
+		{"albumartist", albumArtist, want.AlbumArtist},
+		{"tracknumber", strconv.Itoa(track), strconv.Itoa(want.Track)},
+		{"isrc", customTag(fileTags, "ISRC"), want.ISRC},
+		{"label", customTag(fileTags, "LABEL"), want.Label},
+		{"qobuz_track_id", customTag(fileTags, "QOBUZ_TRACK_ID"), want.QobuzTrackID},
+		{"qobuz_album_id", customTag(fileTags, "QOBUZ_ALBUM_ID"), want.QobuzAlbumID},
+	} {
+		if field.got != field.want {
+			mismatched = append(mismatched, field.name)
+		}
+	}
+
+	return mismatched, nil
+}
+
+// customTag reads one of the fields written by tagFields, name is its vorbis
+// comment name.
+func customTag(fileTags tag.Metadata, name string) string {
+	var (
+		value string
+		err   error
+	)
+
+	switch fileTags := fileTags.(type) {
+	case *tag.FLAC:
+		return fileTags.Tags[name]
+	case *tag.ID3v24:
+		if frame, ok := id3Frames[name]; ok {
+			value, err = fileTags.GetString(frame)
+		} else {
+			value, err = fileTags.GetStringTXXX(name)
+		}
+	case *tag.ID3v23:
+		if frame, ok := id3Frames[name]; ok {
+			value, err = fileTags.GetString(frame)
+		} else {
+			value, err = fileTags.GetStringTXXX(name)
+		}
+	}
+
+	if err != nil {
+		return ""
+	}
+
+	return value
+}
+
+// artistTag maps a multi-valued artist tag back to want.Artist when it holds
+// want.Artists. FLAC is read as the last value, ID3v2 as the joined frame.
+func artistTag(got string, want common.Metadata) string {
+	if slices.Contains(want.Artists, got) ||
+		got == strings.Join(want.Artists, id3v24Separator) ||
+		got == strings.Join(want.Artists, id3v23Separator) {
+		return want.Artist
+	}
+
+	return got
+}
@@ -11,13 +11,15 @@ var Album = &cobra.Command{
 	Short: "Download an album",
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := GetClientFromContext(cmd.Context())
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
 		if err != nil {
 			return errors.Wrap(err, "unable to get client from context")
 		}
 
 		for _, id := range args {
-			err = client.DownloadAlbum(id)
+			err = client.DownloadAlbum(ctx, id)
 			if err != nil {
 				return errors.Wrap(err, "unable to download album")
 			}
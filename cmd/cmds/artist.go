@@ -0,0 +1,30 @@
+package cmds
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+//nolint:exhaustruct,gochecknoglobals
+var Artist = &cobra.Command{
+	Use:   "artist <id> [id...]",
+	Short: "Download the discography of an artist",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to get client from context")
+		}
+
+		for _, id := range args {
+			err = client.DownloadArtist(ctx, id)
+			if err != nil {
+				return errors.Wrap(err, "unable to download artist")
+			}
+		}
+
+		return nil
+	},
+}
@@ -14,12 +14,14 @@ import (
 
 //nolint:gochecknoglobals,exhaustruct
 var Debug = &cobra.Command{
-	Use:    "debug <album|tracki|favorites|search> <id|type|search-query>",
+	Use:    "debug <album|tracki|favorites|purchases|search> <id|type|search-query>",
 	Short:  "Debug commands",
 	Hidden: true,
 	Args:   cobra.MinimumNArgs(2), //nolint:gomnd
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := GetClientFromContext(cmd.Context())
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
 		if err != nil {
 			return errors.Wrap(err, "unable to get client from context")
 		}
@@ -28,47 +30,44 @@ var Debug = &cobra.Command{
 
 		switch args[0] {
 		case "album":
-			res, err = client.AlbumGet(args[1])
+			res, err = client.AlbumGet(ctx, args[1])
 			if err != nil {
 				return errors.Wrap(err, "unable to get album")
 			}
 		case "track":
 			//nolint:gomnd
 			if len(args) > 2 {
-				var format qlient.TrackFormat
-
-				switch strings.ToUpper(args[2]) {
-				case "MP3":
-					format = qlient.QualityMP3
-				case "FLAC":
-					format = qlient.QualityFLAC
-				case "HIRES":
-					format = qlient.QualityHIRES
-				case "MAX":
-					format = qlient.QualityMAX
+				format, err := qlient.ParseTrackFormat(args[2])
+				if err != nil {
+					return errors.Wrap(err, "unable to parse format")
 				}
 
-				res, err = client.TrackGetFileURL(args[1], format)
+				intent := qlient.IntentStream
+				if len(args) > 3 {
+					intent = qlient.FileIntent(args[3])
+				}
+
+				res, err = client.TrackGetFileURL(ctx, args[1], format, intent)
 				if err != nil {
 					return errors.Wrap(err, "unable to get track url")
 				}
 			} else {
-				res, err = client.TrackGet(args[1])
+				res, err = client.TrackGet(ctx, args[1])
 				if err != nil {
 					return errors.Wrap(err, "unable to get track")
 				}
 			}
 		case "favorites":
 			if args[1] == "albums-tracks" {
-				fres, err := client.FavoriteGetUserFavorites(qlient.ListTypeALBUM, 0)
-				if err != nil {
-					return errors.Wrap(err, "unable to get favorite")
+				pages := client.FavoriteGetUserFavorites(ctx, qlient.ListTypeALBUM)
+				if !pages.Next() {
+					return errors.Wrap(pages.Err(), "unable to get favorite")
 				}
 
 				var alist []any
 
-				for _, album := range fres.Albums.Items {
-					ares, err := client.AlbumGet(album.ID)
+				for _, album := range pages.Page().Albums.Items {
+					ares, err := client.AlbumGet(ctx, album.ID)
 					if err != nil {
 						return errors.Wrap(err, "unable to get album")
 					}
@@ -81,12 +80,21 @@ var Debug = &cobra.Command{
 				break
 			}
 
-			res, err = client.FavoriteGetUserFavorites(qlient.ListType(args[1]), 0)
-			if err != nil {
-				return errors.Wrap(err, "unable to get favorite")
+			pages := client.FavoriteGetUserFavorites(ctx, qlient.ListType(args[1]))
+			if !pages.Next() {
+				return errors.Wrap(pages.Err(), "unable to get favorite")
+			}
+
+			res = pages.Page()
+		case "purchases":
+			pages := client.PurchaseGetUserPurchases(ctx, qlient.ListType(args[1]))
+			if !pages.Next() {
+				return errors.Wrap(pages.Err(), "unable to get purchases")
 			}
+
+			res = pages.Page()
 		case "search":
-			res, err = client.Search(strings.Join(args[1:], " "))
+			res, err = client.Search(ctx, strings.Join(args[1:], " "))
 			if err != nil {
 				return errors.Wrap(err, "unable to search")
 			}
@@ -2,38 +2,55 @@ package cmds
 
 import (
 	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
 //nolint:exhaustruct,gochecknoglobals
 var Favorites = &cobra.Command{
-	Use:   "favorites <albums|tracks|albums+tracks>",
-	Short: "Download all favorite albums and/or tracks",
+	Use:   "favorites <albums|tracks|albums+tracks|artists>",
+	Short: "Download all favorite albums and/or tracks, or new releases of favorite artists",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := GetClientFromContext(cmd.Context())
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
 		if err != nil {
 			return errors.Wrap(err, "unable to get client from context")
 		}
 
+		mirror, err := mirrorOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
 		switch args[0] {
 		case "albums":
-			err = client.FavoriteAlbums()
+			err = client.FavoriteAlbums(ctx, mirror)
 			if err != nil {
 				return errors.Wrap(err, "unable to download favorite albums")
 			}
 		case "tracks":
-			err = client.FavoriteTracks()
+			err = client.FavoriteTracks(ctx, mirror)
 			if err != nil {
 				return errors.Wrap(err, "unable to download favorite tracks")
 			}
+		case "artists":
+			if mirror.Enabled {
+				log.Warn().Msg("mirror mode is not supported for artists, ignoring")
+			}
+
+			err = client.FavoriteArtists(ctx)
+			if err != nil {
+				return errors.Wrap(err, "unable to download favorite artists")
+			}
 		case "albums+tracks", "tracks+albums":
-			err = client.FavoriteTracks()
+			err = client.FavoriteTracks(ctx, mirror)
 			if err != nil {
 				return errors.Wrap(err, "unable to download favorite tracks")
 			}
 
-			err = client.FavoriteAlbums()
+			err = client.FavoriteAlbums(ctx, mirror)
 			if err != nil {
 				return errors.Wrap(err, "unable to download favorite albums and tracks")
 			}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
 	"github.com/trevorstarick/qobuz-sync/client"
 )
 
@@ -17,3 +18,36 @@ func GetClientFromContext(ctx context.Context) (*client.Client, error) {
 		return nil, errors.New("client is not a *Client")
 	}
 }
+
+// AddMirrorFlags registers the flags read by mirrorOptionsFromFlags.
+func AddMirrorFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("mirror", false, "remove what is no longer part of the list after syncing")
+	cmd.Flags().Bool("prune", false, "delete removed items instead of moving them to _archive")
+	cmd.Flags().Bool("dry-run", false, "only report what mirror mode would remove")
+	cmd.Flags().Int("mirror-limit", client.DefaultMirrorLimit, "maximum number of items to remove in one run, 0 disables the limit")
+}
+
+func mirrorOptionsFromFlags(cmd *cobra.Command) (client.MirrorOptions, error) {
+	var (
+		opts client.MirrorOptions
+		err  error
+	)
+
+	for flag, value := range map[string]*bool{
+		"mirror":  &opts.Enabled,
+		"prune":   &opts.Prune,
+		"dry-run": &opts.DryRun,
+	} {
+		*value, err = cmd.Flags().GetBool(flag)
+		if err != nil {
+			return opts, errors.Wrapf(err, "unable to get %v flag", flag)
+		}
+	}
+
+	opts.Limit, err = cmd.Flags().GetInt("mirror-limit")
+	if err != nil {
+		return opts, errors.Wrap(err, "unable to get mirror-limit flag")
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,71 @@
+package cmds
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	qlient "github.com/trevorstarick/qobuz-sync/client"
+	"github.com/trevorstarick/qobuz-sync/common"
+)
+
+//nolint:exhaustruct,gochecknoglobals
+var Label = &cobra.Command{
+	Use:   "label <id> [id...]",
+	Short: "Download the catalog of a label",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to get client from context")
+		}
+
+		filter, err := labelFilterFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		for _, id := range args {
+			err = client.DownloadLabel(ctx, id, filter)
+			if err != nil {
+				return errors.Wrap(err, "unable to download label")
+			}
+		}
+
+		return nil
+	},
+}
+
+func labelFilterFromFlags(cmd *cobra.Command) (qlient.LabelFilter, error) {
+	var filter qlient.LabelFilter
+
+	genres, err := cmd.Flags().GetStringSlice("genre")
+	if err != nil {
+		return filter, errors.Wrap(err, "unable to get genre flag")
+	}
+
+	filter.Genres = genres
+
+	for flag, date := range map[string]*time.Time{
+		"since": &filter.Since,
+		"until": &filter.Until,
+	} {
+		value, err := cmd.Flags().GetString(flag)
+		if err != nil {
+			return filter, errors.Wrapf(err, "unable to get %v flag", flag)
+		}
+
+		if value == "" {
+			continue
+		}
+
+		*date, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return filter, errors.Wrapf(common.ErrInvalidArgs, "invalid %v date %q, expected YYYY-MM-DD", flag, value)
+		}
+	}
+
+	return filter, nil
+}
@@ -8,16 +8,18 @@ import (
 //nolint:exhaustruct,gochecknoglobals
 var Link = &cobra.Command{
 	Use:   "link <url> [url...]",
-	Short: "Download an album or track from a URL",
+	Short: "Download an album, artist, label, playlist or track from a URL",
 	Args:  cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		for _, url := range args {
-			client, err := GetClientFromContext(cmd.Context())
+			ctx := cmd.Context()
+
+			client, err := GetClientFromContext(ctx)
 			if err != nil {
 				return errors.Wrap(err, "unable to get client from context")
 			}
 
-			err = client.Link(url)
+			err = client.Link(ctx, url)
 			if err != nil {
 				return errors.Wrap(err, "unable to download link")
 			}
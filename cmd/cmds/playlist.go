@@ -7,17 +7,44 @@ import (
 
 //nolint:exhaustruct,gochecknoglobals
 var Playlist = &cobra.Command{
-	Use:   "playlist <id> [id...]",
+	Use:   "playlist [id...]",
 	Short: "Download a playlist",
-	Args:  cobra.MinimumNArgs(1),
+	Args: func(cmd *cobra.Command, args []string) error {
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			return errors.Wrap(err, "unable to get all flag")
+		}
+
+		if all == (len(args) > 0) {
+			return errors.New("requires either playlist ids or --all")
+		}
+
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := GetClientFromContext(cmd.Context())
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
 		if err != nil {
 			return errors.Wrap(err, "unable to get client from context")
 		}
 
+		mirror, err := mirrorOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		all, err := cmd.Flags().GetBool("all")
+		if err != nil {
+			return errors.Wrap(err, "unable to get all flag")
+		}
+
+		if all {
+			return errors.Wrap(client.AllPlaylists(ctx, mirror), "unable to sync playlists")
+		}
+
 		for _, id := range args {
-			err = client.DownloadPlaylist(id)
+			err = client.DownloadPlaylist(ctx, id, mirror)
 			if err != nil {
 				return errors.Wrap(err, "unable to download playlist")
 			}
@@ -0,0 +1,30 @@
+package cmds
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+//nolint:exhaustruct,gochecknoglobals
+var Purchases = &cobra.Command{
+	Use:   "purchases",
+	Short: "Download all purchased albums and tracks",
+	Long: "Download all purchased albums and tracks with the download intent. Purchased albums already on disk\n" +
+		"get their missing tracks and goodies, tracks already on disk are only replaced with --force.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to get client from context")
+		}
+
+		err = client.Purchases(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to download purchases")
+		}
+
+		return nil
+	},
+}
@@ -24,12 +24,14 @@ var Search = &cobra.Command{
 	Args:  cobra.MinimumNArgs(1),
 	// Hidden: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := GetClientFromContext(cmd.Context())
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
 		if err != nil {
 			return errors.Wrap(err, "unable to get client from context")
 		}
 
-		res, err := client.Search(strings.Join(args, " "))
+		res, err := client.Search(ctx, strings.Join(args, " "))
 		if err != nil {
 			return errors.Wrap(err, "unable to search")
 		}
@@ -11,13 +11,15 @@ var Track = &cobra.Command{
 	Short: "Download a track",
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client, err := GetClientFromContext(cmd.Context())
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
 		if err != nil {
 			return errors.Wrap(err, "unable to get client from context")
 		}
 
 		for _, id := range args {
-			err = client.DownloadTrack(id)
+			err = client.DownloadTrack(ctx, id)
 			if err != nil {
 				return errors.Wrap(err, "unable to download track")
 			}
@@ -0,0 +1,33 @@
+package cmds
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+//nolint:exhaustruct,gochecknoglobals
+var Upgrade = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Replace downloaded tracks that are now available in a better quality",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to get client from context")
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return errors.Wrap(err, "unable to get dry-run flag")
+		}
+
+		err = client.Upgrade(ctx, dryRun)
+		if err != nil {
+			return errors.Wrap(err, "unable to upgrade tracks")
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,53 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	qlient "github.com/trevorstarick/qobuz-sync/client"
+)
+
+//nolint:exhaustruct,gochecknoglobals
+var Verify = &cobra.Command{
+	Use:   "verify",
+	Short: "Check downloaded files against the tracker and print a JSON report",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+
+		client, err := GetClientFromContext(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to get client from context")
+		}
+
+		tags, err := cmd.Flags().GetBool("tags")
+		if err != nil {
+			return errors.Wrap(err, "unable to get tags flag")
+		}
+
+		repair, err := cmd.Flags().GetBool("repair")
+		if err != nil {
+			return errors.Wrap(err, "unable to get repair flag")
+		}
+
+		report, err := client.Verify(ctx, qlient.VerifyOptions{
+			Tags:   tags,
+			Repair: repair,
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to verify library")
+		}
+
+		bytes, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "unable to marshal report")
+		}
+
+		fmt.Fprintf(os.Stdout, "%s\n", bytes)
+
+		return nil
+	},
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -20,6 +24,9 @@ var (
 	DefaultBaseDir = "downloads"
 	Version        = "dev"
 	Revision       = ""
+
+	// cancelRun releases the run deadline set by preRun
+	cancelRun context.CancelFunc = func() {}
 )
 
 //nolint:gochecknoglobals
@@ -75,12 +82,221 @@ var preRun = func(cmd *cobra.Command, _ []string) error {
 		return errors.Wrap(err, "unable to get force flag")
 	}
 
-	c, err := client.NewClient(username, password, baseDir, force)
+	resync := envOrDefault("QOBUZ_RESYNC", "false") == "true"
+	if cmd.Flags().Changed("resync") {
+		resync, err = cmd.Flags().GetBool("resync")
+		if err != nil {
+			return errors.Wrap(err, "unable to get resync flag")
+		}
+	}
+
+	jobs := client.DefaultJobs
+	if os.Getenv("QOBUZ_JOBS") != "" {
+		jobs, err = strconv.Atoi(os.Getenv("QOBUZ_JOBS"))
+		if err != nil {
+			return errors.Wrap(err, "unable to parse QOBUZ_JOBS")
+		}
+	}
+
+	if cmd.Flags().Changed("jobs") {
+		jobs, err = cmd.Flags().GetInt("jobs")
+		if err != nil {
+			return errors.Wrap(err, "unable to get jobs flag")
+		}
+	}
+
+	qualityChain := envOrDefault("QOBUZ_QUALITY", client.DefaultQuality.String())
+	if cmd.Flags().Changed("quality") {
+		qualityChain, err = cmd.Flags().GetString("quality")
+		if err != nil {
+			return errors.Wrap(err, "unable to get quality flag")
+		}
+	}
+
+	quality, err := client.ParseQuality(qualityChain)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse quality")
+	}
+
+	strictQuality := envOrDefault("QOBUZ_QUALITY_STRICT", "false") == "true"
+	if cmd.Flags().Changed("quality-strict") {
+		strictQuality, err = cmd.Flags().GetBool("quality-strict")
+		if err != nil {
+			return errors.Wrap(err, "unable to get quality-strict flag")
+		}
+	}
+
+	coverSize := client.DefaultCoverSize
+	if os.Getenv("QOBUZ_COVER_SIZE") != "" {
+		coverSize, err = strconv.Atoi(os.Getenv("QOBUZ_COVER_SIZE"))
+		if err != nil {
+			return errors.Wrap(err, "unable to parse QOBUZ_COVER_SIZE")
+		}
+	}
+
+	if cmd.Flags().Changed("cover-size") {
+		coverSize, err = cmd.Flags().GetInt("cover-size")
+		if err != nil {
+			return errors.Wrap(err, "unable to get cover-size flag")
+		}
+	}
+
+	releaseTypes := envOrDefault("QOBUZ_RELEASE_TYPES", "")
+	if cmd.Flags().Changed("release-types") {
+		releaseTypes, err = cmd.Flags().GetString("release-types")
+		if err != nil {
+			return errors.Wrap(err, "unable to get release-types flag")
+		}
+	}
+
+	releases := client.ReleaseFilter{Types: nil, Unofficial: false}
+
+	if releaseTypes != "" {
+		releases.Types, err = client.ParseReleaseTypes(releaseTypes)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse release types")
+		}
+	}
+
+	releases.Unofficial = envOrDefault("QOBUZ_UNOFFICIAL", "false") == "true"
+	if cmd.Flags().Changed("unofficial") {
+		releases.Unofficial, err = cmd.Flags().GetBool("unofficial")
+		if err != nil {
+			return errors.Wrap(err, "unable to get unofficial flag")
+		}
+	}
+
+	playlistFormats := envOrDefault("QOBUZ_PLAYLIST_FORMAT", "m3u")
+	if cmd.Flags().Changed("playlist-format") {
+		playlistFormats, err = cmd.Flags().GetString("playlist-format")
+		if err != nil {
+			return errors.Wrap(err, "unable to get playlist-format flag")
+		}
+	}
+
+	playlistOutputs, err := client.ParsePlaylistOutputs(playlistFormats)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse playlist formats")
+	}
+
+	requestTimeout := client.DefaultRequestTimeout
+	if os.Getenv("QOBUZ_REQUEST_TIMEOUT") != "" {
+		requestTimeout, err = time.ParseDuration(os.Getenv("QOBUZ_REQUEST_TIMEOUT"))
+		if err != nil {
+			return errors.Wrap(err, "unable to parse QOBUZ_REQUEST_TIMEOUT")
+		}
+	}
+
+	if cmd.Flags().Changed("request-timeout") {
+		requestTimeout, err = cmd.Flags().GetDuration("request-timeout")
+		if err != nil {
+			return errors.Wrap(err, "unable to get request-timeout flag")
+		}
+	}
+
+	retries := client.DefaultRetries
+	if os.Getenv("QOBUZ_RETRIES") != "" {
+		retries, err = strconv.Atoi(os.Getenv("QOBUZ_RETRIES"))
+		if err != nil {
+			return errors.Wrap(err, "unable to parse QOBUZ_RETRIES")
+		}
+	}
+
+	if cmd.Flags().Changed("retries") {
+		retries, err = cmd.Flags().GetInt("retries")
+		if err != nil {
+			return errors.Wrap(err, "unable to get retries flag")
+		}
+	}
+
+	retryBudget := client.DefaultRetryBudget
+	if os.Getenv("QOBUZ_RETRY_BUDGET") != "" {
+		retryBudget, err = strconv.Atoi(os.Getenv("QOBUZ_RETRY_BUDGET"))
+		if err != nil {
+			return errors.Wrap(err, "unable to parse QOBUZ_RETRY_BUDGET")
+		}
+	}
+
+	if cmd.Flags().Changed("retry-budget") {
+		retryBudget, err = cmd.Flags().GetInt("retry-budget")
+		if err != nil {
+			return errors.Wrap(err, "unable to get retry-budget flag")
+		}
+	}
+
+	rateLimit := client.DefaultRateLimit
+	if os.Getenv("QOBUZ_RATE_LIMIT") != "" {
+		rateLimit, err = strconv.ParseFloat(os.Getenv("QOBUZ_RATE_LIMIT"), 64)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse QOBUZ_RATE_LIMIT")
+		}
+	}
+
+	if cmd.Flags().Changed("rate-limit") {
+		rateLimit, err = cmd.Flags().GetFloat64("rate-limit")
+		if err != nil {
+			return errors.Wrap(err, "unable to get rate-limit flag")
+		}
+	}
+
+	fileURLRateLimit := client.DefaultFileURLRateLimit
+	if os.Getenv("QOBUZ_FILE_URL_RATE_LIMIT") != "" {
+		fileURLRateLimit, err = strconv.ParseFloat(os.Getenv("QOBUZ_FILE_URL_RATE_LIMIT"), 64)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse QOBUZ_FILE_URL_RATE_LIMIT")
+		}
+	}
+
+	if cmd.Flags().Changed("file-url-rate-limit") {
+		fileURLRateLimit, err = cmd.Flags().GetFloat64("file-url-rate-limit")
+		if err != nil {
+			return errors.Wrap(err, "unable to get file-url-rate-limit flag")
+		}
+	}
+
+	timeout := time.Duration(0)
+	if os.Getenv("QOBUZ_TIMEOUT") != "" {
+		timeout, err = time.ParseDuration(os.Getenv("QOBUZ_TIMEOUT"))
+		if err != nil {
+			return errors.Wrap(err, "unable to parse QOBUZ_TIMEOUT")
+		}
+	}
+
+	if cmd.Flags().Changed("timeout") {
+		timeout, err = cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return errors.Wrap(err, "unable to get timeout flag")
+		}
+	}
+
+	ctx := cmd.Context()
+	if timeout > 0 {
+		ctx, cancelRun = context.WithTimeout(ctx, timeout)
+	}
+
+	c, err := client.NewClient(ctx, username, password, client.Options{
+		BaseDir:       baseDir,
+		Force:         force,
+		Resync:        resync,
+		Jobs:          jobs,
+		Quality:       quality,
+		StrictQuality: strictQuality,
+		CoverSize:     coverSize,
+		Releases:      releases,
+
+		PlaylistOutputs: playlistOutputs,
+		RequestTimeout:  requestTimeout,
+		Retries:         retries,
+		RetryBudget:     retryBudget,
+
+		RateLimit:        rateLimit,
+		FileURLRateLimit: fileURLRateLimit,
+	})
 	if err != nil {
 		return errors.Wrap(err, "unable to create client")
 	}
 
-	ctx := context.WithValue(cmd.Context(), client.Key{}, c)
+	ctx = context.WithValue(ctx, client.Key{}, c)
 	cmd.SetContext(ctx)
 
 	return nil
@@ -148,20 +364,73 @@ func main() {
 	cmd.PersistentFlags().String("username", "", "Qobuz username")
 	cmd.PersistentFlags().String("password", "", "Qobuz password")
 	cmd.PersistentFlags().Bool("force", false, "force download even if file exists")
+	cmd.PersistentFlags().Bool("resync", false,
+		"ignore saved sync state, checkpoints and watermarks without downloading existing files again")
+	cmd.PersistentFlags().IntP("jobs", "j", client.DefaultJobs, "number of tracks to download in parallel")
+	cmd.PersistentFlags().StringP("quality", "q", client.DefaultQuality.String(),
+		"ranked list of formats to accept (max, hires, flac, mp3, lossless, any)")
+	cmd.PersistentFlags().Bool("quality-strict", false, "skip tracks not available in the first quality")
+	cmd.PersistentFlags().Int("cover-size", client.DefaultCoverSize,
+		"maximum width/height of the cover embedded in every track, 0 disables embedding")
+
+	cmd.PersistentFlags().String("release-types", "album,ep,live,compilation",
+		"releases to download from an artist (album, ep, live, compilation, appears-on, all)")
+	cmd.PersistentFlags().Bool("unofficial", false, "also download releases not flagged as official")
+
+	cmd.PersistentFlags().Duration("request-timeout", client.DefaultRequestTimeout,
+		"abort a request when the server keeps it waiting this long, 0 disables it")
+	cmd.PersistentFlags().Duration("timeout", 0, "abort the whole run after this long, 0 disables it")
+	cmd.PersistentFlags().Int("retries", client.DefaultRetries, "how many times a failed request is retried")
+	cmd.PersistentFlags().Int("retry-budget", client.DefaultRetryBudget, "how many retries the whole run may spend")
+	cmd.PersistentFlags().Float64("rate-limit", client.DefaultRateLimit,
+		"API requests per second at most, 0 disables the limit")
+	cmd.PersistentFlags().Float64("file-url-rate-limit", client.DefaultFileURLRateLimit,
+		"file url requests per second at most, 0 disables the limit")
+
+	cmd.PersistentFlags().String("playlist-format", "m3u",
+		"playlist files to write (m3u, m3u8, pls, xspf, jspf), each optionally suffixed with :relative or :absolute")
 
 	cmds.Debug.PersistentFlags().String("output", "spew", "output format (json, spew)")
 	cmd.AddCommand(cmds.Debug)
 
+	cmds.AddMirrorFlags(cmds.Favorites)
+	cmds.AddMirrorFlags(cmds.Playlist)
+	cmds.Playlist.Flags().Bool("all", false, "sync every playlist you own or follow")
+
+	cmds.Label.Flags().String("since", "", "only albums released on or after this date (YYYY-MM-DD)")
+	cmds.Label.Flags().String("until", "", "only albums released on or before this date (YYYY-MM-DD)")
+	cmds.Label.Flags().StringSlice("genre", nil, "only albums of these genres")
+
+	cmds.Upgrade.Flags().Bool("dry-run", false, "only list the tracks that can be upgraded")
+
+	cmds.Verify.Flags().Bool("tags", true,
+		"compare title, album, artists, track number, ISRC, label and Qobuz ids with Qobuz (one request per track)")
+	cmds.Verify.Flags().Bool("repair", false, "re-download broken items and remove orphaned .part files")
+
 	cmd.AddCommand(
 		cmds.Album,
+		cmds.Artist,
+		cmds.Label,
 		cmds.Track,
 		cmds.Search,
 		cmds.Playlist,
 		cmds.Favorites,
+		cmds.Purchases,
 		cmds.Link,
+		cmds.Upgrade,
+		cmds.Verify,
 	)
 
-	err = cmd.Execute()
+	// the first interrupt cancels the run so partial files are cleaned up,
+	// a second one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+
+	err = cmd.ExecuteContext(ctx)
+
+	cancelRun()
+	stop()
+
 	if err != nil {
 		os.Exit(1)
 	}
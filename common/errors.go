@@ -1,6 +1,12 @@
 package common
 
-import "github.com/pkg/errors"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
 
 var (
 	ErrAlreadyExists  = errors.New("file already exists")
@@ -10,4 +16,54 @@ var (
 	ErrNotImplemented = errors.New("not implemented")
 	ErrNotFound       = errors.New("not found")
 	ErrBadRequest     = errors.New("bad request")
+
+	ErrQualityUnavailable = errors.New("requested quality unavailable")
+	ErrInvalidContent     = errors.New("unexpected content")
+
+	ErrRateLimited          = errors.New("rate limited")
+	ErrServerError          = errors.New("server error")
+	ErrGeoRestricted        = errors.New("not available in this country")
+	ErrSubscriptionRequired = errors.New("subscription required")
 )
+
+// APIError is a response with an error status. It matches Err, one of the
+// sentinels above, with errors.Is.
+type APIError struct {
+	Err     error
+	Status  int
+	Message string
+	// RetryAfter is how long the server asked to wait, 0 when it didn't
+	RetryAfter time.Duration
+}
+
+func (err *APIError) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("%v: status %d", err.Err, err.Status)
+	}
+
+	return fmt.Sprintf("%v: status %d: %v", err.Err, err.Status, err.Message)
+}
+
+func (err *APIError) Unwrap() error {
+	return err.Err
+}
+
+// ContentError is returned when a download doesn't carry the signature of
+// any of the expected types. It matches ErrInvalidContent with errors.Is.
+type ContentError struct {
+	Expected []string
+	Got      string
+}
+
+func (err *ContentError) Error() string {
+	got := err.Got
+	if got == "" {
+		got = "unknown content"
+	}
+
+	return fmt.Sprintf("%v: expected %v, got %v", ErrInvalidContent, strings.Join(err.Expected, " or "), got)
+}
+
+func (*ContentError) Is(target error) bool {
+	return target == ErrInvalidContent //nolint:errorlint,goerr113
+}
@@ -15,4 +15,42 @@ type Metadata struct {
 	Track       int
 	TrackTotal  int
 	Title       string
+
+	// Genres holds every genre of the album, Genre is the main one
+	Genres          []string
+	AlbumArtistSort string
+	ArtistSort      string
+	Version         string
+	ISRC            string
+	Barcode         string
+	Label           string
+	Copyright       string
+	Explicit        bool
+
+	ReplayGainTrackGain float64 // dB
+	ReplayGainTrackPeak float64
+
+	// Credits parsed from the performers string, Artist and Composer are
+	// the main ones
+	Artists    []string
+	Composers  []string
+	Conductors []string
+	Producers  []string
+	Mixers     []string
+	Lyricists  []string
+	// Performers maps an instrument (or voice) to whoever played it
+	Performers map[string][]string
+
+	QobuzTrackID string
+	QobuzAlbumID string
+
+	Cover *Picture
+}
+
+// Picture is an encoded image ready to be embedded as front cover.
+type Picture struct {
+	MIME   string
+	Width  int
+	Height int
+	Data   []byte
 }
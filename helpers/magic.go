@@ -0,0 +1,114 @@
+package helpers
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// File signatures, see https://en.wikipedia.org/wiki/List_of_file_signatures
+
+const (
+	MimeFLAC = "audio/flac"
+	MimeMP3  = "audio/mpeg"
+	MimeJPEG = "image/jpeg"
+	MimePNG  = "image/png"
+	MimePDF  = "application/pdf"
+	MimeZIP  = "application/zip"
+	MimeMP4  = "video/mp4"
+
+	// sniffLen is enough bytes to tell every known signature apart
+	sniffLen = 8
+)
+
+func IsFLAC(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("fLaC"))
+}
+
+// IsMP3 matches either an ID3v2 tag or a bare MPEG audio frame sync.
+func IsMP3(header []byte) bool {
+	if bytes.HasPrefix(header, []byte("ID3")) {
+		return true
+	}
+
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0
+}
+
+func IsJPEG(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0xFF, 0xD8, 0xFF})
+}
+
+func IsPNG(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'})
+}
+
+func IsPDF(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("%PDF-"))
+}
+
+func IsZIP(header []byte) bool {
+	return bytes.HasPrefix(header, []byte{'P', 'K', 0x03, 0x04})
+}
+
+// IsMP4 matches the ftyp box that starts every ISO base media file.
+func IsMP4(header []byte) bool {
+	return len(header) >= 8 && bytes.Equal(header[4:8], []byte("ftyp"))
+}
+
+// SniffContentType returns the mime type matching the signature at the start
+// of header or an empty string when nothing matches.
+func SniffContentType(header []byte) string {
+	switch {
+	case IsFLAC(header):
+		return MimeFLAC
+	case IsJPEG(header):
+		return MimeJPEG
+	case IsPNG(header):
+		return MimePNG
+	case IsPDF(header):
+		return MimePDF
+	case IsZIP(header):
+		return MimeZIP
+	case IsMP4(header):
+		return MimeMP4
+	case IsMP3(header):
+		return MimeMP3
+	default:
+		return ""
+	}
+}
+
+// Sniff peeks at the start of r and returns its content type along with a
+// reader that still yields every byte of r.
+func Sniff(r io.Reader) (string, io.Reader, error) {
+	buffered := bufio.NewReader(r)
+
+	header, err := buffered.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, errors.Wrap(err, "unable to read header")
+	}
+
+	return SniffContentType(header), buffered, nil
+}
+
+// SniffFile returns the content type of the file at path.
+func SniffFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to open file")
+	}
+
+	defer file.Close()
+
+	header := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", errors.Wrap(err, "unable to read header")
+	}
+
+	return SniffContentType(header[:n]), nil
+}
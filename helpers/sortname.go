@@ -0,0 +1,18 @@
+package helpers
+
+import "strings"
+
+//nolint:gochecknoglobals
+var sortArticles = []string{"The ", "A ", "An "}
+
+// SortName moves a leading English article to the end of name, so
+// "The Beatles" sorts as "Beatles, The".
+func SortName(name string) string {
+	for _, article := range sortArticles {
+		if len(name) > len(article) && strings.EqualFold(name[:len(article)], article) {
+			return name[len(article):] + ", " + strings.TrimSpace(name[:len(article)])
+		}
+	}
+
+	return name
+}
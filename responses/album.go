@@ -1,15 +1,9 @@
 package responses
 
 import (
-	"io"
-	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/pkg/errors"
-	"github.com/rs/zerolog/log"
-	"github.com/trevorstarick/qobuz-sync/common"
 	"github.com/trevorstarick/qobuz-sync/helpers"
 )
 
@@ -52,7 +46,7 @@ type Album struct {
 	Awards                         []any     `json:"awards"`
 	Description                    string    `json:"description"`
 	DescriptionLanguage            string    `json:"description_language"`
-	Goodies                        []any     `json:"goodies"`
+	Goodies                        []Goodie  `json:"goodies"`
 	Area                           any       `json:"area"`
 	Catchline                      string    `json:"catchline"`
 	Composer                       *Artist   `json:"composer"`
@@ -89,55 +83,30 @@ func (album *Album) Path() string {
 	return albumPath
 }
 
-func (album *Album) DownloadAlbumArt(dir string) error {
-	err := os.MkdirAll(dir, common.DirPerm)
-	if err != nil {
-		return errors.Wrap(err, "failed to create dir")
-	}
-
-	_, err = os.Stat(filepath.Join(dir, "album.jpg"))
-	if err == nil {
-		return common.ErrAlreadyExists
-	}
-
-	url := strings.ReplaceAll(album.Image.Large, "_600", "_org")
-	log.Debug().Str("url", url).Str("dir", dir).Msg("downloading album art")
+// Genres returns the album's genres without their parents, GenresList holds
+// paths such as "Pop/Rock→Rock".
+func (album *Album) Genres() []string {
+	genres := make([]string, 0, len(album.GenresList))
+	seen := make(map[string]bool)
 
-	// do some basic verification that the url is valid
-	if !strings.HasPrefix(url, "https://static.qobuz.com/images/covers/") {
-		return errors.New("invalid album art url")
-	}
-
-	res, err := http.Get(url) //nolint:noctx,gosec // we validate the url above
-	if err != nil {
-		return errors.Wrap(err, "failed to get album art")
-	}
+	for _, path := range album.GenresList {
+		parts := strings.Split(path, "→")
+		genre := strings.TrimSpace(parts[len(parts)-1])
 
-	defer func() {
-		if closeErr := res.Body.Close(); closeErr != nil {
-			err = errors.Wrap(err, "failed to close m3u file")
+		if genre != "" && !seen[genre] {
+			seen[genre] = true
+			genres = append(genres, genre)
 		}
-	}()
-
-	albumArt, err := os.OpenFile(filepath.Join(dir, "album.jpg"), os.O_CREATE|os.O_WRONLY, common.FilePerm)
-	if err != nil {
-		return errors.Wrap(err, "failed to create file")
 	}
 
-	defer func() {
-		if syncErr := albumArt.Sync(); syncErr != nil {
-			err = errors.Wrap(err, "failed to sync file")
-		}
-
-		if closeErr := albumArt.Close(); closeErr != nil {
-			err = errors.Wrap(err, "failed to close file")
-		}
-	}()
-
-	_, err = io.Copy(albumArt, res.Body)
-	if err != nil {
-		return errors.Wrap(err, "failed to copy response body")
+	if len(genres) == 0 && album.Genre.Name != "" {
+		genres = append(genres, album.Genre.Name)
 	}
 
-	return nil
+	return genres
+}
+
+// OriginalImageURL returns the url of the cover in its original size.
+func (album *Album) OriginalImageURL() string {
+	return strings.ReplaceAll(album.Image.Large, "_600", "_org")
 }
@@ -0,0 +1,14 @@
+package artistget
+
+import "github.com/trevorstarick/qobuz-sync/responses"
+
+type Response struct {
+	*responses.Artist
+
+	Albums struct {
+		Offset int               `json:"offset"`
+		Limit  int               `json:"limit"`
+		Total  int               `json:"total"`
+		Items  []responses.Album `json:"items"`
+	} `json:"albums"`
+}
@@ -0,0 +1,12 @@
+package responses
+
+// Goodie is an extra shipped with an album, usually a PDF booklet.
+type Goodie struct {
+	ID           int    `json:"id"`
+	FileFormatID int    `json:"file_format_id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	URL          string `json:"url"`
+	OriginalURL  string `json:"original_url"`
+	ProductID    int    `json:"product_id"`
+}
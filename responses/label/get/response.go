@@ -0,0 +1,17 @@
+package labelget
+
+import "github.com/trevorstarick/qobuz-sync/responses"
+
+type Response struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	AlbumsCount int    `json:"albums_count"`
+
+	Albums struct {
+		Offset int               `json:"offset"`
+		Limit  int               `json:"limit"`
+		Total  int               `json:"total"`
+		Items  []responses.Album `json:"items"`
+	} `json:"albums"`
+}
@@ -0,0 +1,161 @@
+package responses
+
+import (
+	"slices"
+	"strings"
+)
+
+// Credit is one person or ensemble of a performers string with their roles.
+type Credit struct {
+	Name  string
+	Roles []string
+}
+
+type creditRole int
+
+const (
+	roleIgnored creditRole = iota
+	roleArtist
+	roleComposer
+	roleLyricist
+	roleComposerLyricist
+	roleConductor
+	roleProducer
+	roleMixer
+)
+
+// creditRoles classifies the roles Qobuz uses, keys are lowercase without
+// spaces or dashes. Anything not listed is taken as an instrument.
+//
+//nolint:gochecknoglobals
+var creditRoles = map[string]creditRole{
+	"mainartist":          roleArtist,
+	"artist":              roleArtist,
+	"featuredartist":      roleArtist,
+	"composer":            roleComposer,
+	"writer":              roleComposer,
+	"songwriter":          roleComposer,
+	"lyricist":            roleLyricist,
+	"author":              roleLyricist,
+	"librettist":          roleLyricist,
+	"composerlyricist":    roleComposerLyricist,
+	"conductor":           roleConductor,
+	"producer":            roleProducer,
+	"coproducer":          roleProducer,
+	"mixer":               roleMixer,
+	"mixingengineer":      roleMixer,
+	"performer":           roleIgnored,
+	"associatedperformer": roleIgnored,
+	"arranger":            roleIgnored,
+	"engineer":            roleIgnored,
+	"recordingengineer":   roleIgnored,
+	"masteringengineer":   roleIgnored,
+	"soundengineer":       roleIgnored,
+	"assistantengineer":   roleIgnored,
+	"executiveproducer":   roleIgnored,
+	"studiopersonnel":     roleIgnored,
+	"programmer":          roleIgnored,
+	"label":               roleIgnored,
+	"publisher":           roleIgnored,
+	"musicpublisher":      roleIgnored,
+	"copyright":           roleIgnored,
+	"remixer":             roleIgnored,
+}
+
+// Credits is a parsed performers string.
+type Credits []Credit
+
+// ParsePerformers splits a performers string such as
+// "Name, MainArtist - Other, Composer, Producer" into credits. Credits are
+// separated by " - ", the name comes first and is followed by its roles.
+func ParsePerformers(performers string) Credits {
+	credits := make(Credits, 0)
+
+	for _, part := range strings.Split(performers, " - ") {
+		fields := strings.Split(part, ",")
+
+		name := strings.TrimSpace(fields[0])
+		if name == "" {
+			continue
+		}
+
+		roles := make([]string, 0, len(fields)-1)
+
+		for _, role := range fields[1:] {
+			if role = strings.TrimSpace(role); role != "" {
+				roles = append(roles, role)
+			}
+		}
+
+		credits = append(credits, Credit{Name: name, Roles: roles})
+	}
+
+	return credits
+}
+
+func roleOf(role string) (creditRole, bool) {
+	key := strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(role))
+	kind, ok := creditRoles[key]
+
+	return kind, ok
+}
+
+// with returns the names credited with any of the given roles in order.
+func (credits Credits) with(kinds ...creditRole) []string {
+	names := make([]string, 0)
+
+	for _, credit := range credits {
+		for _, role := range credit.Roles {
+			kind, ok := roleOf(role)
+			if ok && slices.Contains(kinds, kind) && !slices.Contains(names, credit.Name) {
+				names = append(names, credit.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+func (credits Credits) Artists() []string {
+	return credits.with(roleArtist)
+}
+
+func (credits Credits) Composers() []string {
+	return credits.with(roleComposer, roleComposerLyricist)
+}
+
+func (credits Credits) Lyricists() []string {
+	return credits.with(roleLyricist, roleComposerLyricist)
+}
+
+func (credits Credits) Conductors() []string {
+	return credits.with(roleConductor)
+}
+
+func (credits Credits) Producers() []string {
+	return credits.with(roleProducer)
+}
+
+func (credits Credits) Mixers() []string {
+	return credits.with(roleMixer)
+}
+
+// Performers maps every instrument, lowercased, to the names playing it.
+func (credits Credits) Performers() map[string][]string {
+	performers := make(map[string][]string)
+
+	for _, credit := range credits {
+		for _, role := range credit.Roles {
+			if _, ok := roleOf(role); ok {
+				continue
+			}
+
+			instrument := strings.ToLower(role)
+			if !slices.Contains(performers[instrument], credit.Name) {
+				performers[instrument] = append(performers[instrument], credit.Name)
+			}
+		}
+	}
+
+	return performers
+}
@@ -0,0 +1,174 @@
+package responses
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestParsePerformers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		performers string
+		credits    Credits
+	}{
+		{
+			name:       "empty",
+			performers: "",
+			credits:    Credits{},
+		},
+		{
+			name:       "several roles",
+			performers: "Daft Punk, MainArtist - Thomas Bangalter, Composer, Lyricist, Producer",
+			credits: Credits{
+				{Name: "Daft Punk", Roles: []string{"MainArtist"}},
+				{Name: "Thomas Bangalter", Roles: []string{"Composer", "Lyricist", "Producer"}},
+			},
+		},
+		{
+			name:       "dash within a name",
+			performers: "Jean-Pierre Rampal, Flute - Orchestre de chambre Jean-François Paillard, Orchestra",
+			credits: Credits{
+				{Name: "Jean-Pierre Rampal", Roles: []string{"Flute"}},
+				{Name: "Orchestre de chambre Jean-François Paillard", Roles: []string{"Orchestra"}},
+			},
+		},
+		{
+			name:       "blank and extra separators",
+			performers: " - Miles Davis, MainArtist, , Trumpet,  -  - , Composer - Bill Evans , Piano - ",
+			credits: Credits{
+				{Name: "Miles Davis", Roles: []string{"MainArtist", "Trumpet"}},
+				{Name: "Bill Evans", Roles: []string{"Piano"}},
+			},
+		},
+		{
+			name:       "no roles",
+			performers: "Nina Simone",
+			credits:    Credits{{Name: "Nina Simone", Roles: []string{}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			credits := ParsePerformers(test.performers)
+
+			equal := slices.EqualFunc(credits, test.credits, func(a, b Credit) bool {
+				return a.Name == b.Name && slices.Equal(a.Roles, b.Roles)
+			})
+			if !equal {
+				t.Errorf("got %q, want %q", credits, test.credits)
+			}
+		})
+	}
+}
+
+func TestCreditRoles(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		performers string
+		artists    []string
+		composers  []string
+		lyricists  []string
+		conductors []string
+		producers  []string
+		mixers     []string
+		instrument map[string][]string
+	}{
+		{
+			name: "pop credits",
+			performers: "Daft Punk, MainArtist - Pharrell Williams, FeaturedArtist, Vocals, ComposerLyricist" +
+				" - Nile Rodgers, Guitar, Composer - Thomas Bangalter, Producer, Composer" +
+				" - Mick Guzauski, Mixing Engineer - Bob Ludwig, Mastering Engineer",
+			artists:    []string{"Daft Punk", "Pharrell Williams"},
+			composers:  []string{"Pharrell Williams", "Nile Rodgers", "Thomas Bangalter"},
+			lyricists:  []string{"Pharrell Williams"},
+			conductors: nil,
+			producers:  []string{"Thomas Bangalter"},
+			mixers:     []string{"Mick Guzauski"},
+			instrument: map[string][]string{"vocals": {"Pharrell Williams"}, "guitar": {"Nile Rodgers"}},
+		},
+		{
+			name: "classical credits",
+			performers: "Berliner Philharmoniker, Orchestra, MainArtist - Herbert von Karajan, Conductor, MainArtist" +
+				" - Ludwig van Beethoven, Composer - Michel Glotz, Producer, Co-Producer" +
+				" - Anne-Sophie Mutter, Violin, Associated Performer",
+			artists:    []string{"Berliner Philharmoniker", "Herbert von Karajan"},
+			composers:  []string{"Ludwig van Beethoven"},
+			lyricists:  nil,
+			conductors: []string{"Herbert von Karajan"},
+			producers:  []string{"Michel Glotz"},
+			mixers:     nil,
+			instrument: map[string][]string{"orchestra": {"Berliner Philharmoniker"}, "violin": {"Anne-Sophie Mutter"}},
+		},
+		{
+			name: "shared instrument",
+			performers: "John Coltrane, MainArtist, Tenor Saxophone - McCoy Tyner, Piano" +
+				" - Jimmy Garrison, Double Bass - Art Davis, Double Bass - Art Davis, Double Bass",
+			artists:    []string{"John Coltrane"},
+			composers:  nil,
+			lyricists:  nil,
+			conductors: nil,
+			producers:  nil,
+			mixers:     nil,
+			instrument: map[string][]string{
+				"tenor saxophone": {"John Coltrane"},
+				"piano":           {"McCoy Tyner"},
+				"double bass":     {"Jimmy Garrison", "Art Davis"},
+			},
+		},
+		{
+			name:       "unknown role is an instrument",
+			performers: "Björk, MainArtist, Lyricist - Mark Bell, Programming Wizard, Co-Producer - Sjón, Author, Label",
+			artists:    []string{"Björk"},
+			composers:  nil,
+			lyricists:  []string{"Björk", "Sjón"},
+			conductors: nil,
+			producers:  []string{"Mark Bell"},
+			mixers:     nil,
+			instrument: map[string][]string{"programming wizard": {"Mark Bell"}},
+		},
+		{
+			name:       "spelling of roles",
+			performers: "Sade, main artist, COMPOSER - Mike Pela, mixing-engineer, Co Producer",
+			artists:    []string{"Sade"},
+			composers:  []string{"Sade"},
+			lyricists:  nil,
+			conductors: nil,
+			producers:  []string{"Mike Pela"},
+			mixers:     []string{"Mike Pela"},
+			instrument: map[string][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			credits := ParsePerformers(test.performers)
+
+			for role, got := range map[string][][]string{
+				"artists":    {credits.Artists(), test.artists},
+				"composers":  {credits.Composers(), test.composers},
+				"lyricists":  {credits.Lyricists(), test.lyricists},
+				"conductors": {credits.Conductors(), test.conductors},
+				"producers":  {credits.Producers(), test.producers},
+				"mixers":     {credits.Mixers(), test.mixers},
+			} {
+				if !slices.Equal(got[0], got[1]) {
+					t.Errorf("got %v %q, want %q", role, got[0], got[1])
+				}
+			}
+
+			performers := credits.Performers()
+			if !maps.EqualFunc(performers, test.instrument, slices.Equal) {
+				t.Errorf("got performers %q, want %q", performers, test.instrument)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package playlistgetuserplaylists
+
+type Response struct {
+	User struct {
+		ID    int    `json:"id"`
+		Login string `json:"login"`
+	} `json:"user"`
+	Playlists struct {
+		Offset int        `json:"offset"`
+		Limit  int        `json:"limit"`
+		Total  int        `json:"total"`
+		Items  []Playlist `json:"items"`
+	} `json:"playlists"`
+}
+
+type Playlist struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	TracksCount int    `json:"tracks_count"`
+	UpdatedAt   int    `json:"updated_at"`
+	Owner       struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"owner"`
+}
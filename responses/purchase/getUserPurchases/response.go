@@ -0,0 +1,20 @@
+package purchasegetuserpurchases
+
+import "github.com/trevorstarick/qobuz-sync/responses"
+
+type Response struct {
+	Albums AlbumsRes `json:"albums"`
+	Tracks TracksRes `json:"tracks"`
+}
+type AlbumsRes struct {
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+	Total  int               `json:"total"`
+	Items  []responses.Album `json:"items"`
+}
+type TracksRes struct {
+	Offset int               `json:"offset"`
+	Limit  int               `json:"limit"`
+	Total  int               `json:"total"`
+	Items  []responses.Track `json:"items"`
+}
@@ -84,11 +84,33 @@ func (t Track) Metadata() common.Metadata {
 		composer = t.Composer.Name
 	}
 
+	copyright := t.Copyright
+	if copyright == "" {
+		copyright = t.Album.Copyright
+	}
+
+	label := ""
+	if t.Album.Label != nil {
+		label = t.Album.Label.Name
+	}
+
+	credits := ParsePerformers(t.Performers)
+
+	artists := credits.Artists()
+	if len(artists) == 0 {
+		artists = []string{t.Performer.Name}
+	}
+
+	composers := credits.Composers()
+	if len(composers) == 0 && composer != "" {
+		composers = []string{composer}
+	}
+
 	return common.Metadata{
 		Album:       t.Album.Title,
 		AlbumArtist: t.Album.Artist.Name,
 		Artist:      t.Performer.Name,
-		Comment:     fmt.Sprintf("qobuz_id: %v", t.ID),
+		Comment:     "",
 		Composer:    composer,
 		Genre:       t.Album.Genre.Name,
 		Date:        time.Unix(int64(t.Album.ReleasedAt), 0),
@@ -97,5 +119,31 @@ func (t Track) Metadata() common.Metadata {
 		Track:       t.TrackNumber,
 		TrackTotal:  t.Album.TracksCount,
 		Title:       t.Title,
+
+		Genres:          t.Album.Genres(),
+		AlbumArtistSort: helpers.SortName(t.Album.Artist.Name),
+		ArtistSort:      helpers.SortName(t.Performer.Name),
+		Version:         t.Version,
+		ISRC:            t.Isrc,
+		Barcode:         t.Album.Upc,
+		Label:           label,
+		Copyright:       copyright,
+		Explicit:        t.ParentalWarning,
+
+		Artists:    artists,
+		Composers:  composers,
+		Conductors: credits.Conductors(),
+		Producers:  credits.Producers(),
+		Mixers:     credits.Mixers(),
+		Lyricists:  credits.Lyricists(),
+		Performers: credits.Performers(),
+
+		ReplayGainTrackGain: t.AudioInfo.ReplaygainTrackGain,
+		ReplayGainTrackPeak: t.AudioInfo.ReplaygainTrackPeak,
+
+		QobuzTrackID: strconv.Itoa(t.ID),
+		QobuzAlbumID: t.Album.ID,
+
+		Cover: nil,
 	}
 }
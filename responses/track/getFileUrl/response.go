@@ -9,6 +9,8 @@ type Response struct {
 	Restrictions []Restrictions `json:"restrictions"`
 	SamplingRate float64        `json:"sampling_rate"`
 	BitDepth     int            `json:"bit_depth"`
+	// Sample is set when only a preview can be streamed
+	Sample bool `json:"sample"`
 }
 type Restrictions struct {
 	Code string `json:"code"`